@@ -3,8 +3,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -12,13 +17,17 @@ import (
 type MoveParams struct {
 	CardOne     *Card
 	CardTwo     *Card
+	Position    int32 // Where to put a minion played from hand, 1-based. 0 means the right end.
 	Description string
+	Chance      bool // Not a choice, but one possible outcome of a draw. CardOne is the card drawn.
 }
 
 type DecisionTreeNode struct {
 	Gs                 *GameState
 	Moves              []*MoveParams
-	SuccessProbability float32
+	SuccessProbability float32 // The chance of the draws in Moves all going our way.
+	LineProbability    float32 // The chance that some draw wins after the same moves. See LineChances.
+	Hash               uint64  // See hashNode.
 }
 
 func getPrettyCardDesc(card *Card, careAboutCost bool) string {
@@ -101,19 +110,30 @@ func generateNode(node *DecisionTreeNode, move *MoveParams) *DecisionTreeNode {
 	return &DecisionTreeNode{
 		Gs:                 newGs,
 		Moves:              newMoves,
-		SuccessProbability: 1.0, // TODO: Actually think about this.
+		SuccessProbability: node.SuccessProbability,
+		Hash:               hashNode(newGs, newMoves),
 	}
 }
 
 func canCardAttack(card *Card) bool {
-	return !(card.NumAttacksThisTurn > 0 || (card.Exhausted && !card.Charge) || card.Frozen || card.Attack == 0)
+	maxAttacks := int32(1)
+	if card.hasWindfury() {
+		maxAttacks = 2
+	}
+	return !(card.NumAttacksThisTurn >= maxAttacks || (card.Exhausted && !card.Charge) || card.Frozen || card.Attack == 0)
+}
+
+// Can our attacks, spells and battlecries pick this card? Enemies hide
+// behind Stealth and Immune.
+func canTarget(card *Card) bool {
+	if getSide(card.Zone) != "OPPOSING" {
+		return true
+	}
+	return !card.hasStealth() && !card.Immune
 }
 
 // Enumerate all of the possible next moves from the given GameState.
-// TODO things this function does not currently consider:
-//  Immune enemies (these are rare).
-//  Hero power (this is not due to complexity but mostly because it probably won't help us win).
-func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode) {
+func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode, pruning *PruningOpts) {
 	// Pre-compute some useful stuff.
 	friendlyHero := getSingletonFromZone(node.Gs, "FRIENDLY PLAY (Hero)", true)
 	if friendlyHero == nil {
@@ -125,21 +145,21 @@ func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode
 	}
 	enemyTauntExists := false
 	for enemyMinion := range node.Gs.CardsByZone["OPPOSING PLAY"] {
-		if enemyMinion.Taunt {
+		if enemyMinion.Taunt && canTarget(enemyMinion) {
 			enemyTauntExists = true
 			break
 		}
 	}
 
 	// Minions can attack minions or face.
-	for _, friendlyMinion := range GlobalPruningOpts.getCardsFromFriendlyZone(node.Gs, "FRIENDLY PLAY") {
+	for _, friendlyMinion := range pruning.getCardsFromFriendlyZone(node.Gs, "FRIENDLY PLAY") {
 		if !canCardAttack(friendlyMinion) {
 			// This minion can't attack.
 			//fmt.Printf("DEBUG: %v is in play but can't attack for some reason.\n", friendlyMinion.Name)
 			continue
 		}
-		for _, enemyMinion := range GlobalPruningOpts.getCardsInOpposingPlay(node.Gs) {
-			if enemyTauntExists && !enemyMinion.Taunt {
+		for _, enemyMinion := range pruning.getCardsInOpposingPlay(node.Gs) {
+			if (enemyTauntExists && !enemyMinion.Taunt) || !canTarget(enemyMinion) {
 				// This minion can't be attacked.
 				//fmt.Printf("DEBUG: %v is protected by a taunt minion.\n", enemyMinion.Name)
 				continue
@@ -148,7 +168,7 @@ func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode
 			desc := fmt.Sprintf("%v attacks %v", getPrettyCardDesc(friendlyMinion, false), getPrettyCardDesc(enemyMinion, false))
 			workChan <- generateNode(node, &MoveParams{CardOne: friendlyMinion, CardTwo: enemyMinion, Description: desc})
 		}
-		if !enemyTauntExists {
+		if !enemyTauntExists && canTarget(enemyHero) {
 			// Attack face
 			desc := fmt.Sprintf("%v attacks face (%v)", getPrettyCardDesc(friendlyMinion, false), getPrettyCardDesc(enemyHero, false))
 			workChan <- generateNode(node, &MoveParams{CardOne: friendlyMinion, CardTwo: enemyHero, Description: desc})
@@ -157,8 +177,8 @@ func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode
 
 	// Hero can attack minions or face with a weapon.
 	if canCardAttack(friendlyHero) {
-		for _, enemyMinion := range GlobalPruningOpts.getCardsInOpposingPlay(node.Gs) {
-			if enemyTauntExists && !enemyMinion.Taunt {
+		for _, enemyMinion := range pruning.getCardsInOpposingPlay(node.Gs) {
+			if (enemyTauntExists && !enemyMinion.Taunt) || !canTarget(enemyMinion) {
 				// This minion can't be attacked.
 				//fmt.Printf("DEBUG: %v is protected by a taunt minion.\n", getPrettyCardDesc(enemyMinion)
 				continue
@@ -166,21 +186,39 @@ func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode
 			desc := fmt.Sprintf("You (%v) attack %v", getPrettyCardDesc(friendlyHero, false), getPrettyCardDesc(enemyMinion, false))
 			workChan <- generateNode(node, &MoveParams{CardOne: friendlyHero, CardTwo: enemyMinion, Description: desc})
 		}
-		if !enemyTauntExists {
+		if !enemyTauntExists && canTarget(enemyHero) {
 			// Attack face
 			desc := fmt.Sprintf("You (%v) attack face (%v)", getPrettyCardDesc(friendlyHero, false), getPrettyCardDesc(enemyHero, false))
 			workChan <- generateNode(node, &MoveParams{CardOne: friendlyHero, CardTwo: enemyHero, Description: desc})
 		}
 	}
 
-	// Spells, Minions, and Weapons can be played including targets maybe.
 	numFriendlyMinions := len(node.Gs.CardsByZone["FRIENDLY PLAY"])
 	availableMana := node.Gs.ManaMax - node.Gs.ManaUsed + node.Gs.ManaTemp
-    cardsInHand := GlobalPruningOpts.getCardsFromFriendlyZone(node.Gs, "FRIENDLY HAND")
+
+	// The hero power, once a turn.
+	heroPower := getSingletonFromZone(node.Gs, "FRIENDLY PLAY (Hero Power)", false)
+	if heroPower != nil && !heroPower.Exhausted && heroPower.Cost <= availableMana {
+		filter := getPlayCardTargetFilter(heroPower)
+		descPrefix := fmt.Sprintf("Use %v", getPrettyCardDesc(heroPower, true))
+		if filter(nil) {
+			workChan <- generateNode(node, &MoveParams{CardOne: heroPower, CardTwo: nil, Description: descPrefix})
+		} else {
+			for _, target := range node.Gs.CardsById {
+				if filter(target) && canTarget(target) {
+					desc := fmt.Sprintf("%v on %v", descPrefix, getPrettyCardDesc(target, false))
+					workChan <- generateNode(node, &MoveParams{CardOne: heroPower, CardTwo: target, Description: desc})
+				}
+			}
+		}
+	}
+
+	// Spells, Minions, and Weapons can be played including targets maybe.
+    cardsInHand := pruning.getCardsFromFriendlyZone(node.Gs, "FRIENDLY HAND")
     // The Coin optimization
     // If any card in hand is The Coin, we play it as soon as it would be useful, and then return so that all
     // children do not have The Coin in the hand any more.
-    if GlobalPruningOpts.useCoinOptimization {
+    if pruning.useCoinOptimization {
         var theCoin *Card
         for _, cardInHand := range cardsInHand {
             if cardInHand.JsonCardId == "GAME_005" {
@@ -196,12 +234,17 @@ func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode
         }
     }
 	for _, cardInHand := range cardsInHand {
+		if cardInHand.JsonCardId == "" {
+			// We drew something, but we don't know our deck.
+			continue
+		}
 		if cardInHand.Cost > availableMana {
 			// Too expensive.
 			//fmt.Printf("DEBUG: %v is too expensive to play.\n", getPrettyCardDesc(cardInHand)
 			continue
 		}
 		var descPrefix string
+		positions := []int32{0}
 		switch cardInHand.Type {
 		case "Spell":
 			descPrefix = fmt.Sprintf("Cast %v", getPrettyCardDesc(cardInHand, true))
@@ -213,23 +256,34 @@ func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode
 				continue
 			}
 			descPrefix = fmt.Sprintf("Play %v", getPrettyCardDesc(cardInHand, true))
+			if placementMatters(node.Gs, cardInHand) {
+				positions = make([]int32, numFriendlyMinions+1)
+				for i := range positions {
+					positions[i] = int32(i + 1)
+				}
+			}
 		}
 		filter := getPlayCardTargetFilter(cardInHand)
-		if filter(nil) {
-			workChan <- generateNode(node, &MoveParams{CardOne: cardInHand, CardTwo: nil, Description: descPrefix})
-		} else {
+		for _, position := range positions {
+			if position > 0 {
+				descPrefix = fmt.Sprintf("Play %v %v", getPrettyCardDesc(cardInHand, true), describePlacement(node.Gs, position))
+			}
+			if filter(nil) {
+				workChan <- generateNode(node, &MoveParams{CardOne: cardInHand, CardTwo: nil, Position: position, Description: descPrefix})
+				continue
+			}
 			couldTargetAny := false
 			for _, target := range node.Gs.CardsById {
-				if filter(target) {
+				if filter(target) && canTarget(target) {
 					couldTargetAny = true
 					desc := fmt.Sprintf("%v on %v", descPrefix, getPrettyCardDesc(target, false))
-					workChan <- generateNode(node, &MoveParams{CardOne: cardInHand, CardTwo: target, Description: desc})
+					workChan <- generateNode(node, &MoveParams{CardOne: cardInHand, CardTwo: target, Position: position, Description: desc})
 				}
 			}
 			if !couldTargetAny {
 				if cardInHand.Type == "Minion" {
 					//fmt.Printf("DEBUG: Allowing %v to be played without a target since none exist.\n", getPrettyCardDesc(cardInHand)
-					workChan <- generateNode(node, &MoveParams{CardOne: cardInHand, CardTwo: nil, Description: descPrefix})
+					workChan <- generateNode(node, &MoveParams{CardOne: cardInHand, CardTwo: nil, Position: position, Description: descPrefix})
 				} else {
 					//fmt.Printf("DEBUG: No valid targets for %v.\n", getPrettyCardDesc(cardInHand)
 				}
@@ -238,85 +292,366 @@ func generateNextNodes(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode
 	}
 }
 
-func WalkDecisionTree(gs *GameState, solutionChan chan<- *DecisionTreeNode, abortChan chan time.Time) {
-	unsortedWorkChan, lowPriWorkChan := make(chan *DecisionTreeNode, 1000000), make(chan *DecisionTreeNode, 1000000)
-	softTimeout1Chan, softTimeout2Chan, softTimeout3Chan := time.After(time.Second*30), time.After(time.Second*50), time.After(time.Second*70)
-	timeoutChan := time.After(time.Second * 300)
-	var totalNodes, maxDepth int
-	var deepestNode *DecisionTreeNode
-	anySolution := false
+// Where a minion played at the given position ends up, in words.
+func describePlacement(gs *GameState, position int32) string {
+	ordered := gs.getOrderedZone("FRIENDLY PLAY")
+	if int(position) > len(ordered) {
+		if len(ordered) == 0 {
+			return "on an empty board"
+		}
+		return "on the far right"
+	}
+	return fmt.Sprintf("to the left of %v", getPrettyCardDesc(ordered[position-1], false))
+}
+
+// Counters describing one walk of the decision tree.
+type SearchStats struct {
+	NodesExplored  int
+	NodesDropped   int // Left unexplored because the frontier was full.
+	Transpositions int // Not expanded because an identical node was already queued.
+	MaxDepth       int
+	Solutions      int
+	Elapsed        time.Duration
+	StoppedBy      string // Why the search ended: one of the SEARCH_STOPPED_* reasons.
+}
+
+const (
+	SEARCH_STOPPED_EXHAUSTED = "exhausted"     // Every line was considered.
+	SEARCH_STOPPED_FRONTIER  = "frontier full" // Nothing left to consider, but some lines were dropped.
+	SEARCH_STOPPED_CANCELLED = "cancelled"
+	SEARCH_STOPPED_DEADLINE  = "deadline"
+	SEARCH_STOPPED_NODES     = "node budget"
+	SEARCH_STOPPED_MEMORY    = "memory budget"
+)
+
+// Whether the search considered every line, so any lethal there is was found.
+func (stats SearchStats) Exhausted() bool {
+	return stats.StoppedBy == SEARCH_STOPPED_EXHAUSTED
+}
+
+// How many of the nodes the search came across it had seen before.
+func (stats SearchStats) TranspositionHitRate() float64 {
+	if stats.NodesExplored == 0 {
+		return 0
+	}
+	return float64(stats.Transpositions) / float64(stats.NodesExplored)
+}
+
+// For when a search found no lethal: how sure we are that there is none.
+func describeNoLethal(stats SearchStats) string {
+	if stats.Exhausted() {
+		return fmt.Sprintf("No lethal this turn, %v nodes explored.", stats.NodesExplored)
+	}
+	return fmt.Sprintf("No lethal found in %v nodes, but the search was incomplete (stopped: %v).", stats.NodesExplored, stats.StoppedBy)
+}
+
+// Defaults for SolverOptions, modest enough to leave room for the game client.
+const (
+	DEFAULT_MAX_FRONTIER = 50000
+	DEFAULT_MAX_MEMORY   = 1 << 30
+)
+
+// SolverOptions.MaxMemory for no limit.
+const NO_MAX_MEMORY = math.MaxUint64
+
+// Turns a -max_memory_mb flag into SolverOptions.MaxMemory. 0 means no limit.
+func maxMemoryFromMb(mb uint64) uint64 {
+	if mb == 0 {
+		return NO_MAX_MEMORY
+	}
+	return mb << 20
+}
+
+// How many node hashes a search remembers, roughly 40MB worth.
+const TRANSPOSITION_TABLE_LIMIT = 1 << 21
+
+// How a Solver searches. The zero value is a reasonable default.
+type SolverOptions struct {
+	Pruning     *PruningOpts  // Defaults to DefaultPruningOpts().
+	Workers     int           // How many nodes to expand at once. Defaults to runtime.GOMAXPROCS.
+	MaxNodes    int           // Stop after exploring this many nodes. 0 for no limit.
+	MaxFrontier int           // How many nodes may wait to be expanded. Defaults to DEFAULT_MAX_FRONTIER.
+	MaxMemory   uint64        // Stop once the heap grows past this many bytes. Defaults to DEFAULT_MAX_MEMORY; NO_MAX_MEMORY for no limit.
+	Deadline    time.Duration // Stop after this long. 0 for no limit besides the context.
+	Verbose     bool          // Print progress, and the deepest line if there's no lethal.
+}
+
+// Searches GameStates for lethal. A Solver holds no state between searches,
+// so one can run several at once (e.g. ours and the opponent's). MaxMemory
+// is checked against the whole process's heap, though, so searches running
+// at the same time share it rather than getting one each.
+type Solver struct {
+	opts SolverOptions
+}
+
+func NewSolver(opts SolverOptions) *Solver {
+	if opts.Pruning == nil {
+		defaultPruning := DefaultPruningOpts()
+		opts.Pruning = &defaultPruning
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.MaxFrontier <= 0 {
+		opts.MaxFrontier = DEFAULT_MAX_FRONTIER
+	}
+	if opts.MaxMemory == 0 {
+		opts.MaxMemory = DEFAULT_MAX_MEMORY
+	}
+	return &Solver{opts: opts}
+}
+
+// One running search, see Solver.Solve.
+type Search struct {
+	// Every solution as it is found. Closed when the search ends, so keep
+	// reading (or cancel the context) until then.
+	Solutions <-chan *DecisionTreeNode
+	done      chan bool
+	stats     SearchStats
+}
 
-	// Sleep briefly before kicking off the work, since it will get cancelled
-	// very quickly in turns where the human operator knows there's no hope.
+// Waits for the search to end and describes it.
+func (s *Search) Wait() SearchStats {
+	<-s.done
+	return s.stats
+}
+
+// Starts searching from `gs` and returns straight away. The search runs until
+// ctx is done or one of the Solver's budgets runs out.
+func (s *Solver) Solve(ctx context.Context, gs *GameState) *Search {
+	var cancel context.CancelFunc
+	if s.opts.Deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.opts.Deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	solutionChan := make(chan *DecisionTreeNode)
+	search := &Search{Solutions: solutionChan, done: make(chan bool)}
 	go func() {
-		//time.Sleep(time.Second)
-		unsortedWorkChan <- &DecisionTreeNode{
-			Gs:                 gs,
-			Moves:              make([]*MoveParams, 0),
-			SuccessProbability: 1.0,
+		defer cancel()
+		s.walkDecisionTree(ctx, gs, solutionChan, &search.stats)
+		close(solutionChan)
+		close(search.done)
+	}()
+	return search
+}
+
+// Searches until the Solver gives up, and returns every distinct solution
+// found (surest first, then fewest moves) along with search statistics.
+func (s *Solver) SolveAll(ctx context.Context, gs *GameState) ([]*DecisionTreeNode, SearchStats) {
+	search := s.Solve(ctx, gs)
+	seen := make(map[string]bool)
+	result := make([]*DecisionTreeNode, 0)
+	lineChances := NewLineChances()
+	for solution := range search.Solutions {
+		if key := getSolutionKey(solution); !seen[key] {
+			seen[key] = true
+			result = append(result, solution)
+			lineChances.Add(solution)
 		}
+	}
+	// Now that every outcome is in, each line's total is final.
+	for _, solution := range result {
+		solution.LineProbability = lineChances.Add(solution)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].SuccessProbability != result[j].SuccessProbability {
+			return result[i].SuccessProbability > result[j].SuccessProbability
+		}
+		return len(result[i].Moves) < len(result[j].Moves)
+	})
+	return result, search.Wait()
+}
+
+// How often (in nodes) to check the heap against MaxMemory. ReadMemStats
+// stops the world, so not too often.
+const MEMORY_CHECK_INTERVAL = 10000
+
+// How many children each worker can hand back before it has to wait for the
+// walk to catch up.
+const CHILD_BUFFER_PER_WORKER = 64
+
+// The walk itself happens on one goroutine, which owns the frontier and all
+// the counters. A fixed pool of workers expands the nodes it hands out and
+// sends the children back, followed by a nil to say that node is done. The
+// search is over when the frontier is empty and no node is being expanded.
+func (s *Solver) walkDecisionTree(ctx context.Context, gs *GameState, solutionChan chan<- *DecisionTreeNode, stats *SearchStats) {
+	startTime := time.Now()
+	pruning := s.opts.Pruning
+	frontier := NewFrontier(s.opts.MaxFrontier)
+	transpositions := NewTranspositionTable(TRANSPOSITION_TABLE_LIMIT)
+	// Both channels are small, so busy workers hold up the walk (and a busy
+	// walk holds up the workers) instead of work piling up in memory.
+	jobChan := make(chan *DecisionTreeNode)
+	childChan := make(chan *DecisionTreeNode, s.opts.Workers*CHILD_BUFFER_PER_WORKER)
+	var workers sync.WaitGroup
+	for i := 0; i < s.opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for node := range jobChan {
+				if node.Gs.PendingDraws > 0 {
+					expandDraws(node, childChan)
+				} else {
+					generateNextNodes(node, childChan, pruning)
+				}
+				childChan <- nil
+			}
+		}()
+	}
+	defer func() {
+		// Let the workers finish their current node, and throw the children away.
+		close(jobChan)
+		go func() {
+			workers.Wait()
+			close(childChan)
+		}()
+		go func() {
+			for range childChan {
+			}
+		}()
 	}()
 
+	var totalNodes, maxDepth, numSolutions, nodesDropped, numTranspositions int
+	outstanding := 0 // Nodes handed to workers that aren't done yet.
+	var deepestNode *DecisionTreeNode
+	anySolution := false
+	gs.assumeAdjacencyAurasApplied()
+
+	stop := func(reason string) {
+		stats.StoppedBy = reason
+	}
+	stopForContext := func() {
+		if ctx.Err() == context.DeadlineExceeded {
+			stop(SEARCH_STOPPED_DEADLINE)
+		} else {
+			stop(SEARCH_STOPPED_CANCELLED)
+		}
+	}
 	defer func() {
-		if deepestNode != nil {
-			fmt.Printf("INFO: WalkDecisionTree exited after considering %v nodes with maxDepth %v.\n", totalNodes, maxDepth)
+		stats.NodesExplored = totalNodes
+		stats.NodesDropped = nodesDropped
+		stats.Transpositions = numTranspositions
+		stats.MaxDepth = maxDepth
+		stats.Solutions = numSolutions
+		stats.Elapsed = time.Since(startTime)
+		if s.opts.Verbose && deepestNode != nil {
+			fmt.Printf("INFO: Solver stopped (%v) after considering %v nodes (%.0f%% transpositions) with maxDepth %v.\n",
+				stats.StoppedBy, totalNodes, stats.TranspositionHitRate()*100, maxDepth)
 			if !anySolution {
 				fmt.Println("Sorry you didn't win. Here is the deepest node discovered:")
 				prettyPrintDecisionTreeNode(deepestNode)
 			}
 		}
 	}()
-	for {
-		select {
-		case <-abortChan:
-			//fmt.Println("DEBUG: Decision tree walk aborting...")
-			return
-		case <-timeoutChan:
-			fmt.Println("DEBUG: Decision tree walk timing out...")
-			return
-		case <-softTimeout1Chan:
-			fmt.Println("WARN: Turn ends in 40 seconds.")
-		case <-softTimeout2Chan:
-			fmt.Println("WARN: Turn ends in 20 seconds.")
-		case <-softTimeout3Chan:
-			fmt.Println("WARN: Turn ended.")
-		case node := <-unsortedWorkChan:
-			if totalNodes == 0 {
-				fmt.Println("DEBUG: Beginning decision tree walk.")
-			}
-			totalNodes += 1
-			if totalNodes%100000 == 0 {
-				fmt.Printf("DEBUG: Seen %v nodes so far.\n", totalNodes)
+
+	// Looks at a new node: reports it if it's a solution, otherwise queues it
+	// for expansion. Returns false when the walk should stop.
+	visit := func(node *DecisionTreeNode) bool {
+		if s.opts.Verbose && totalNodes == 0 {
+			fmt.Println("DEBUG: Beginning decision tree walk.")
+		}
+		if s.opts.MaxNodes > 0 && totalNodes >= s.opts.MaxNodes {
+			stop(SEARCH_STOPPED_NODES)
+			return false
+		}
+		totalNodes += 1
+		if s.opts.Verbose && totalNodes%100000 == 0 {
+			fmt.Printf("DEBUG: Seen %v nodes so far.\n", totalNodes)
+		}
+		if totalNodes%MEMORY_CHECK_INTERVAL == 0 {
+			var memStats runtime.MemStats
+			runtime.ReadMemStats(&memStats)
+			if memStats.HeapAlloc > s.opts.MaxMemory {
+				fmt.Printf("WARN: Solver using %v MB, giving up.\n", memStats.HeapAlloc>>20)
+				stop(SEARCH_STOPPED_MEMORY)
+				return false
 			}
-			depth := len(node.Moves)
-			if depth > maxDepth {
+		}
+		depth := len(node.Moves)
+		if depth > maxDepth {
+			if s.opts.Verbose {
 				fmt.Printf("DEBUG: New depth reached: %v. Seen %v nodes so far.\n", depth, totalNodes)
-				maxDepth = depth
-				deepestNode = node
 			}
-			switch node.Gs.Winner {
-			case FRIENDLY_VICTORY:
-				anySolution = true
-				solutionChan <- node
-			case NO_VICTORY:
-				if GlobalPruningOpts.isNodeHighPriority(node) {
-					go generateNextNodes(node, unsortedWorkChan)
-				} else {
-					go func() { lowPriWorkChan <- node }()
+			maxDepth = depth
+			deepestNode = node
+		}
+		switch node.Gs.Winner {
+		case FRIENDLY_VICTORY:
+			anySolution = true
+			numSolutions += 1
+			select {
+			case solutionChan <- node:
+			case <-ctx.Done():
+				// Nobody is listening for solutions any more.
+				stopForContext()
+				return false
+			}
+		case NO_VICTORY:
+			if pruning.useTranspositionTable && !transpositions.Add(node.Hash) {
+				// Another order of moves got here first.
+				numTranspositions += 1
+				return true
+			}
+			highPriority := node.Gs.PendingDraws > 0 || pruning.isNodeHighPriority(node)
+			if !frontier.Push(node, highPriority) {
+				if nodesDropped == 0 {
+					fmt.Println("WARN: The search frontier is full, some lines will not be considered.")
 				}
-			case OPPOSING_VICTORY_OR_DRAW:
-				// Do nothing
-			default:
-				panic("Unknown Winner state")
+				nodesDropped += 1
 			}
+		case OPPOSING_VICTORY_OR_DRAW:
+			// Do nothing
 		default:
-			select {
-			case node := <-lowPriWorkChan:
-				go generateNextNodes(node, unsortedWorkChan)
-			default:
-				//fmt.Println("DEBUG: No more nodes?")
-				//return
+			panic("Unknown Winner state")
+		}
+		return true
+	}
+
+	if !visit(&DecisionTreeNode{
+		Gs:                 gs,
+		Moves:              make([]*MoveParams, 0),
+		SuccessProbability: 1.0,
+	}) {
+		return
+	}
+	for {
+		if frontier.Len() == 0 && outstanding == 0 {
+			if nodesDropped > 0 {
+				stop(SEARCH_STOPPED_FRONTIER)
+			} else {
+				stop(SEARCH_STOPPED_EXHAUSTED)
 			}
+			return
 		}
+		// Only offer work when there is some, so an idle walk just waits.
+		var dispatchChan chan<- *DecisionTreeNode
+		if frontier.Len() > 0 {
+			dispatchChan = jobChan
+		}
+		select {
+		case <-ctx.Done():
+			//fmt.Println("DEBUG: Decision tree walk aborting...")
+			stopForContext()
+			return
+		case dispatchChan <- frontier.Peek():
+			frontier.Pop()
+			outstanding += 1
+		case node := <-childChan:
+			if node == nil {
+				outstanding -= 1
+			} else if !visit(node) {
+				return
+			}
+		}
+	}
+}
+
+// Two solutions are the same if they describe the same moves.
+func getSolutionKey(node *DecisionTreeNode) string {
+	descs := make([]string, len(node.Moves))
+	for i, move := range node.Moves {
+		descs[i] = move.Description
 	}
+	return strings.Join(descs, "\n")
 }
@@ -2,6 +2,9 @@ package main
 
 import (
 	//"fmt"
+	"context"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -14,64 +17,100 @@ func getAllCardsInZone(gs *GameState, zone string) []*Card {
 	return result
 }
 
-func SetupNaive() {
-	GlobalPruningOpts = PruningOpts{
+func NaivePruningOpts() PruningOpts {
+	return PruningOpts{
 		getCardsFromFriendlyZone: getAllCardsInZone,
 		getCardsInOpposingPlay:   func(gs *GameState) []*Card { return getAllCardsInZone(gs, "OPPOSING PLAY") },
 		isNodeHighPriority:       func(node *DecisionTreeNode) bool { return true },
 	}
 }
 
-func SetupNoPruningWithPriority() {
-	resetGlobalPruningOpts()
-	GlobalPruningOpts = PruningOpts{
+func NoPruningWithPriorityOpts() PruningOpts {
+	return PruningOpts{
 		getCardsFromFriendlyZone: getAllCardsInZone,
 		getCardsInOpposingPlay:   func(gs *GameState) []*Card { return getAllCardsInZone(gs, "OPPOSING PLAY") },
-		isNodeHighPriority:       GlobalPruningOpts.isNodeHighPriority,
+		isNodeHighPriority:       DefaultPruningOpts().isNodeHighPriority,
 	}
 }
 
-func SetupPruningWithoutPriority() {
-	resetGlobalPruningOpts()
-	GlobalPruningOpts = PruningOpts{
-		getCardsFromFriendlyZone: GlobalPruningOpts.getCardsFromFriendlyZone,
-		getCardsInOpposingPlay:   GlobalPruningOpts.getCardsInOpposingPlay,
+func PruningWithoutPriorityOpts() PruningOpts {
+	return PruningOpts{
+		getCardsFromFriendlyZone: DefaultPruningOpts().getCardsFromFriendlyZone,
+		getCardsInOpposingPlay:   DefaultPruningOpts().getCardsInOpposingPlay,
 		isNodeHighPriority:       func(node *DecisionTreeNode) bool { return true },
 	}
 }
 
-func BenchmarkAllToFaceAllOptimizations(t *testing.B) {
-	resetGlobalPruningOpts()
-	AllToFaceTest()
+func BenchmarkAllToFaceAllOptimizations(b *testing.B) {
+	AllToFaceTest(b, DefaultPruningOpts())
 }
 
-func BenchmarkAllToFaceNaive(t *testing.B) {
-	SetupNaive()
-	AllToFaceTest()
+func BenchmarkAllToFaceNoTranspositions(b *testing.B) {
+	pruning := DefaultPruningOpts()
+	pruning.useTranspositionTable = false
+	AllToFaceTest(b, pruning)
 }
 
-func BenchmarkComboInHandAllOptimizations(t *testing.B) {
-	resetGlobalPruningOpts()
-	ComboInHandTest()
+func BenchmarkAllToFaceNaive(b *testing.B) {
+	AllToFaceTest(b, NaivePruningOpts())
 }
 
-func BenchmarkComboInHandNoPruningWithPriority(t *testing.B) {
-	SetupNoPruningWithPriority()
-	ComboInHandTest()
+func BenchmarkComboInHandAllOptimizations(b *testing.B) {
+	ComboInHandTest(b, DefaultPruningOpts())
 }
 
-func BenchmarkComboInHandPruningWithoutPriority(t *testing.B) {
-	SetupPruningWithoutPriority()
-	ComboInHandTest()
+func BenchmarkComboInHandNoTranspositions(b *testing.B) {
+	pruning := DefaultPruningOpts()
+	pruning.useTranspositionTable = false
+	ComboInHandTest(b, pruning)
 }
 
-func BenchmarkComboInHandNaive(t *testing.B) {
-	SetupNaive()
-	ComboInHandTest()
+func BenchmarkComboInHandNoPruningWithPriority(b *testing.B) {
+	ComboInHandTest(b, NoPruningWithPriorityOpts())
 }
 
-func AllToFaceTest() {
-	abortChan := make(chan time.Time, 1)
+func BenchmarkComboInHandPruningWithoutPriority(b *testing.B) {
+	ComboInHandTest(b, PruningWithoutPriorityOpts())
+}
+
+func BenchmarkComboInHandNaive(b *testing.B) {
+	ComboInHandTest(b, NaivePruningOpts())
+}
+
+// Solves `gs` with the given pruning until the first solution.
+func solveUntilFirstSolution(gs *GameState, pruning PruningOpts) (*DecisionTreeNode, SearchStats) {
+	ctx, cancel := context.WithCancel(context.Background())
+	search := NewSolver(SolverOptions{Pruning: &pruning}).Solve(ctx, gs)
+	solution := <-search.Solutions
+	cancel()
+	for range search.Solutions {
+	}
+	return solution, search.Wait()
+}
+
+// Runs solveUntilFirstSolution on a copy of `gs` b.N times, and reports how
+// many nodes that took and how many of them were transpositions.
+func benchmarkFirstSolution(b *testing.B, gs *GameState, pruning PruningOpts) {
+	var solution *DecisionTreeNode
+	var nodes int
+	var hitRate float64
+	for i := 0; i < b.N; i++ {
+		var stats SearchStats
+		solution, stats = solveUntilFirstSolution(gs.DeepCopy(), pruning)
+		nodes += stats.NodesExplored
+		hitRate += stats.TranspositionHitRate()
+	}
+	b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+	b.ReportMetric(100*hitRate/float64(b.N), "%transpositions")
+	prettyPrintDecisionTreeNode(solution)
+}
+
+// Like SolveAll, with nothing but a deadline.
+func solveFor(gs *GameState, budget time.Duration) ([]*DecisionTreeNode, SearchStats) {
+	return NewSolver(SolverOptions{Deadline: budget}).SolveAll(context.Background(), gs)
+}
+
+func AllToFaceTest(b *testing.B, pruning PruningOpts) {
 	gs := createEmptyGameState()
 	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
 	enemyHero.Damage = 12
@@ -84,15 +123,10 @@ func AllToFaceTest() {
 	gs.CreateNewMinion("BRM_019", "FRIENDLY PLAY")
 	gs.CreateNewMinion("BRM_019", "FRIENDLY PLAY")
 
-	solutionChan := make(chan *DecisionTreeNode)
-	go WalkDecisionTree(&gs, solutionChan, abortChan)
-	solution := <-solutionChan
-	abortChan <- time.Now()
-	prettyPrintDecisionTreeNode(solution)
+	benchmarkFirstSolution(b, &gs, pruning)
 }
 
-func ComboInHandTest() {
-	abortChan := make(chan time.Time, 1)
+func ComboInHandTest(b *testing.B, pruning PruningOpts) {
 	gs := createEmptyGameState()
 	gs.ManaMax = 10
 	gs.CreateNewMinion("EX1_084", "FRIENDLY HAND") // Warsong Commander
@@ -116,9 +150,187 @@ func ComboInHandTest() {
 	maexxna := gs.CreateNewMinion("FP1_010", "OPPOSING PLAY") // Maexxna (easy for her to end up as a 2/5)
 	maexxna.Silenced = true
 
-	solutionChan := make(chan *DecisionTreeNode)
-	go WalkDecisionTree(&gs, solutionChan, nil)
-	solution := <-solutionChan
-	abortChan <- time.Now()
-	prettyPrintDecisionTreeNode(solution)
+	benchmarkFirstSolution(b, &gs, pruning)
+}
+
+func TestSolveMain(t *testing.T) {
+	gs := createEmptyGameState()
+	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
+	enemyHero.Damage = 28
+	berserker := gs.CreateNewMinion("EX1_604", "FRIENDLY PLAY") // Frothing Berserker
+	berserker.Exhausted = false
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := SaveGameStateFile(&gs, path); err != nil {
+		t.Fatal(err)
+	}
+	if code := solveMain([]string{"-state", path, "-deadline", "200ms"}); code != SOLVE_EXIT_LETHAL {
+		t.Error("Expected lethal, got exit code", code)
+	}
+
+	enemyHero.Damage = 0
+	if err := SaveGameStateFile(&gs, path); err != nil {
+		t.Fatal(err)
+	}
+	if code := solveMain([]string{"-state", path, "-deadline", "200ms"}); code != SOLVE_EXIT_NO_LETHAL {
+		t.Error("Expected no lethal, got exit code", code)
+	}
+	if code := solveMain([]string{"-state", path + ".missing"}); code != SOLVE_EXIT_ERROR {
+		t.Error("Expected an error, got exit code", code)
+	}
+}
+
+func TestKeywordMoves(t *testing.T) {
+	pruning := DefaultPruningOpts()
+	gs := createEmptyGameState()
+	dragonhawk := gs.CreateNewMinion("CS2_169", "FRIENDLY PLAY") // Young Dragonhawk
+	dragonhawk.Exhausted = false
+	dragonhawk.NumAttacksThisTurn = 1
+	footman := gs.CreateNewMinion("CS1_042", "OPPOSING PLAY") // Goldshire Footman
+	footman.Stealth = true
+	gs.CreateNewMinion("EX1_010", "OPPOSING PLAY") // Worgen Infiltrator
+
+	workChan := make(chan *DecisionTreeNode, 100)
+	generateNextNodes(&DecisionTreeNode{Gs: &gs}, workChan, &pruning)
+	close(workChan)
+	var moves []string
+	for node := range workChan {
+		moves = append(moves, node.Moves[len(node.Moves)-1].Description)
+	}
+	// Windfury allows a second attack, a stealthed taunt doesn't protect
+	// anything, and stealthed minions can't be attacked.
+	if len(moves) != 1 || !strings.Contains(moves[0], "attacks face") {
+		t.Error("Expected only a second attack to face, got", moves)
+	}
+}
+
+func TestDrawChance(t *testing.T) {
+	gs := createEmptyGameState()
+	gs.ManaMax = 3
+	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
+	enemyHero.Damage = 29
+	gs.CreateNewMinion("CS2_023", "FRIENDLY HAND") // Arcane Intellect
+	gs.SetDeckList([]string{"CS2_023", "CS2_008", "CS2_231", "CS2_231", "CS2_231"})
+	if gs.remainingDeckSize() != 4 {
+		t.Fatal("The Arcane Intellect in hand should not count as in the deck:", gs.RemainingDeck)
+	}
+
+	solutions, _ := solveFor(&gs, 300*time.Millisecond)
+	if len(solutions) == 0 {
+		t.Fatal("Expected lethal if we draw Moonfire")
+	}
+	var total float32
+	for _, solution := range solutions {
+		draws := getDraws(solution)
+		if len(draws) != 2 || (draws[0] != "Moonfire" && draws[1] != "Moonfire") {
+			t.Error("Solution doesn't draw Moonfire:", draws)
+		}
+		if solution.SuccessProbability != 0.25 {
+			t.Error("Each order of draws should be a 1 in 4 chance, got", solution.SuccessProbability)
+		}
+		if solution.LineProbability != 0.5 {
+			t.Error("Either order of draws wins, so the line should be a 1 in 2 chance, got", solution.LineProbability)
+		}
+		total += solution.SuccessProbability
+	}
+	if total < 0.5 {
+		t.Error("Expected both orders of draws to be found, got", len(solutions), "solutions")
+	}
+}
+
+func TestHeroPowerMoves(t *testing.T) {
+	pruning := DefaultPruningOpts()
+	gs := createEmptyGameState()
+	gs.ManaMax = 2
+	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
+	enemyHero.Damage = 29
+	dragon := gs.CreateNewMinion("NEW1_023", "OPPOSING PLAY") // Faerie Dragon
+	gs.moveCard(gs.getOrCreateCard("CS2_034", 50), "FRIENDLY PLAY (Hero Power)")
+
+	workChan := make(chan *DecisionTreeNode, 100)
+	generateNextNodes(&DecisionTreeNode{Gs: &gs}, workChan, &pruning)
+	close(workChan)
+	var moves []string
+	for node := range workChan {
+		moves = append(moves, node.Moves[len(node.Moves)-1].Description)
+		if node.Moves[len(node.Moves)-1].CardTwo.InstanceId == dragon.InstanceId {
+			t.Error("Faerie Dragon can't be targeted by hero powers")
+		}
+	}
+	// Both heroes are targets.
+	if len(moves) != 2 {
+		t.Error("Expected Fireblast on each hero, got", moves)
+	}
+
+	solutions, _ := solveFor(&gs, 300*time.Millisecond)
+	if len(solutions) == 0 || !strings.HasPrefix(solutions[0].Moves[0].Description, "Use Fireblast on") {
+		t.Fatal("Expected Fireblast to be lethal")
+	}
+	if heroPower := solutions[0].Gs.CardsById[50]; !heroPower.Exhausted || solutions[0].Gs.ManaUsed != 2 {
+		t.Error("Fireblast should cost 2 mana and be usable once:", heroPower, solutions[0].Gs.ManaUsed)
+	}
+
+	gs.ManaMax = 1
+	if solutions, _ := solveFor(&gs, 100*time.Millisecond); len(solutions) != 0 {
+		t.Error("Fireblast costs too much with only 1 mana")
+	}
+}
+
+func TestSolverBudgets(t *testing.T) {
+	// Big enough that no search gets to the end of it.
+	gs := createEmptyGameState()
+	for i := 0; i < 7; i++ {
+		gs.CreateNewMinion("CS2_182", "FRIENDLY PLAY").Exhausted = false // Chillwind Yeti
+		gs.CreateNewMinion("CS2_182", "OPPOSING PLAY")
+	}
+
+	solver := NewSolver(SolverOptions{MaxNodes: 50, Workers: 2})
+	if _, stats := solver.SolveAll(context.Background(), gs.DeepCopy()); stats.StoppedBy != SEARCH_STOPPED_NODES || stats.NodesExplored != 50 {
+		t.Error("Expected to stop after 50 nodes:", stats)
+	}
+	naive := NaivePruningOpts()
+	tiny := NewSolver(SolverOptions{Pruning: &naive, MaxNodes: 2 * MEMORY_CHECK_INTERVAL, MaxMemory: 1})
+	if _, stats := tiny.SolveAll(context.Background(), gs.DeepCopy()); stats.StoppedBy != SEARCH_STOPPED_MEMORY {
+		t.Error("Expected to run out of memory:", stats)
+	}
+	unlimited := NewSolver(SolverOptions{Pruning: &naive, MaxNodes: 2 * MEMORY_CHECK_INTERVAL, MaxMemory: NO_MAX_MEMORY})
+	if _, stats := unlimited.SolveAll(context.Background(), gs.DeepCopy()); stats.StoppedBy != SEARCH_STOPPED_NODES {
+		t.Error("Expected no memory limit:", stats)
+	}
+
+	// Two searches at once, one of them cancelled straight away.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := NewSolver(SolverOptions{Pruning: &naive}).Solve(ctx, gs.DeepCopy())
+	timed := NewSolver(SolverOptions{Pruning: &naive, Deadline: 100 * time.Millisecond}).Solve(context.Background(), gs.DeepCopy())
+	cancel()
+	for range cancelled.Solutions {
+	}
+	for range timed.Solutions {
+	}
+	if stats := cancelled.Wait(); stats.StoppedBy != SEARCH_STOPPED_CANCELLED {
+		t.Error("Expected the search to be cancelled:", stats)
+	}
+	if stats := timed.Wait(); stats.StoppedBy != SEARCH_STOPPED_DEADLINE {
+		t.Error("Expected the search to hit its deadline:", stats)
+	}
+}
+
+func TestSolverExhaustion(t *testing.T) {
+	gs := createEmptyGameState()
+	gs.CreateNewMinion("CS2_182", "FRIENDLY PLAY").Exhausted = false // Chillwind Yeti
+	gs.CreateNewMinion("CS2_182", "FRIENDLY PLAY").Exhausted = false
+	gs.CreateNewMinion("CS2_182", "OPPOSING PLAY")
+
+	solutions, stats := NewSolver(SolverOptions{Deadline: time.Minute}).SolveAll(context.Background(), gs.DeepCopy())
+	if len(solutions) != 0 || !stats.Exhausted() || stats.NodesExplored < 2 {
+		t.Fatal("Expected to rule out lethal:", stats)
+	}
+	if stats.Elapsed > 10*time.Second {
+		t.Error("Expected to stop as soon as there was nothing left to explore:", stats)
+	}
+
+	// With no room in the frontier, running out of nodes proves nothing.
+	_, stats = NewSolver(SolverOptions{MaxFrontier: 1}).SolveAll(context.Background(), gs.DeepCopy())
+	if stats.StoppedBy != SEARCH_STOPPED_FRONTIER || stats.NodesDropped == 0 {
+		t.Error("Expected some nodes to be dropped:", stats)
+	}
 }
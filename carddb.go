@@ -0,0 +1,155 @@
+// Finding, loading and checking the card data that jsondata.go parses.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Card data to use when no path is given. Overrides the default paths below.
+const CARDS_ENV_VAR = "HEARTHSTONE_CARDS"
+
+// Where to look for card data when no path is given, in order.
+var defaultCardJsonPaths = []string{"cards.json", "AllSets.json"}
+
+// A copy of cards.json built into the binary, if it was built with
+// `-tags embedcards`. See carddb_embed.go.
+var embeddedCardJson []byte
+
+// All the cards we know about, and ways to look them up.
+type CardDatabase struct {
+	Source     string // Where the cards came from, for messages.
+	Cards      map[string]JsonCardData
+	IdsByDbfId map[int32]string
+	idsByName  map[string]string // Lower case name, preferring collectible cards.
+}
+
+// The database newCardFromJson and friends use. Set by setGlobalCardDatabase.
+var GlobalCardDatabase *CardDatabase
+var GlobalCardJsonData map[string]JsonCardData
+var GlobalCardIdsByDbfId map[int32]string
+
+// Loads card data from `path`, or if that's empty from $HEARTHSTONE_CARDS,
+// the embedded copy, or the first of defaultCardJsonPaths that exists.
+// Missing, corrupt or empty data is an error.
+func NewCardDatabase(path string) (*CardDatabase, error) {
+	if path == "" {
+		path = os.Getenv(CARDS_ENV_VAR)
+	}
+	if path == "" && len(embeddedCardJson) > 0 {
+		return newCardDatabaseFromJson("embedded cards.json", embeddedCardJson)
+	}
+	if path == "" {
+		for _, defaultPath := range defaultCardJsonPaths {
+			if _, err := os.Stat(defaultPath); err == nil {
+				path = defaultPath
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no card data found: use -cards, set $%v, or put one of %v in the working directory",
+			CARDS_ENV_VAR, strings.Join(defaultCardJsonPaths, " or "))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newCardDatabaseFromJson(path, data)
+}
+
+func newCardDatabaseFromJson(source string, data []byte) (*CardDatabase, error) {
+	cards, err := parseCardJson(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %v: %v", source, err)
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("no cards in %v", source)
+	}
+	db := &CardDatabase{
+		Source:     source,
+		Cards:      cards,
+		IdsByDbfId: make(map[int32]string),
+		idsByName:  make(map[string]string),
+	}
+	for id, card := range cards {
+		if id == "" || card.Name == "" {
+			return nil, fmt.Errorf("card without an id or name in %v: %+v", source, card)
+		}
+		if card.DbfId != 0 {
+			db.IdsByDbfId[card.DbfId] = id
+		}
+		name := strings.ToLower(card.Name)
+		if existing, ok := db.idsByName[name]; !ok ||
+			(card.Collectible && !cards[existing].Collectible) ||
+			(card.Collectible == cards[existing].Collectible && id < existing) {
+			db.idsByName[name] = id
+		}
+	}
+	return db, nil
+}
+
+// Finds a card by its id or (case insensitive) name.
+func (db *CardDatabase) findJsonCardId(idOrName string) (string, bool) {
+	if _, ok := db.Cards[idOrName]; ok {
+		return idOrName, true
+	}
+	id, ok := db.idsByName[strings.ToLower(idOrName)]
+	return id, ok
+}
+
+// e.g. "1054 cards from AllSets.json: Basic 210, Classic 386, ...".
+func (db *CardDatabase) Summary() string {
+	bySet := make(map[string]int)
+	for _, card := range db.Cards {
+		set := card.Set
+		if set == "" {
+			set = "no set"
+		}
+		bySet[set] += 1
+	}
+	sets := make([]string, 0, len(bySet))
+	for set := range bySet {
+		sets = append(sets, set)
+	}
+	sort.Strings(sets)
+	counts := make([]string, len(sets))
+	for i, set := range sets {
+		counts[i] = fmt.Sprintf("%v %v", set, bySet[set])
+	}
+	return fmt.Sprintf("%v cards from %v: %v", len(db.Cards), db.Source, strings.Join(counts, ", "))
+}
+
+func setGlobalCardDatabase(db *CardDatabase) {
+	GlobalCardDatabase = db
+	GlobalCardJsonData = db.Cards
+	GlobalCardIdsByDbfId = db.IdsByDbfId
+}
+
+func findJsonCardId(idOrName string) (string, bool) {
+	if GlobalCardDatabase == nil {
+		return "", false
+	}
+	return GlobalCardDatabase.findJsonCardId(idOrName)
+}
+
+// The -cards flag every command takes.
+func addCardsFlag(flags *flag.FlagSet) *string {
+	return flags.String("cards", "", fmt.Sprintf("Optional. The card data: cards.json or AllSets.json from hearthstonejson.com. Defaults to $%v.", CARDS_ENV_VAR))
+}
+
+// Loads the card data for a command, or explains why we can't.
+func loadCardDatabase(path string) bool {
+	db, err := NewCardDatabase(path)
+	if err != nil {
+		fmt.Println("ERROR: Cannot load card data:", err.Error())
+		return false
+	}
+	fmt.Println("INFO: Loaded", db.Summary())
+	setGlobalCardDatabase(db)
+	return true
+}
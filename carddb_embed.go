@@ -0,0 +1,15 @@
+//go:build embedcards
+
+// Build with `-tags embedcards` and a cards.json in this directory to carry
+// the card data around inside the binary.
+
+package main
+
+import _ "embed"
+
+//go:embed cards.json
+var embeddedCardJsonFile []byte
+
+func init() {
+	embeddedCardJson = embeddedCardJsonFile
+}
@@ -0,0 +1,189 @@
+// Which cards the solver actually understands, so we know how far to trust
+// it with a given deck.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// How well the solver simulates a card, best first.
+const (
+	COVERAGE_SIMULATED    = iota // Everything the card does is simulated.
+	COVERAGE_VANILLA_ONLY        // Played for its body (or weapon) only; its effects are ignored.
+	COVERAGE_UNSUPPORTED         // Never played at all.
+)
+
+var coverageNames = []string{"SIMULATED", "VANILLA ONLY", "UNSUPPORTED"}
+
+// Mechanics that newCardFromJson or the parser turn into Card fields, and
+// which the engine then handles for every card that has them.
+var keywordMechanics = map[string]bool{
+	"Taunt":                   true,
+	"Charge":                  true,
+	"Divine Shield":           true,
+	"Windfury":                true,
+	"Stealth":                 true,
+	"Poisonous":               true,
+	"Spellpower":              true,
+	"Affected By Spell Power": true, // See getSpellDamage. As normalized from cards.json.
+	"AffectedBySpellPower":    true, // The same, as AllSets.json spells it.
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// Card text that says nothing beyond the keywords above.
+var keywordTextPattern = regexp.MustCompile(htmlTagPattern.String() + `|\[x\]|Taunt|Charge|Divine Shield|Windfury|Stealth|Poisonous|` +
+	spellDamageTextPattern.String() + `|` + strings.TrimPrefix(cantBeTargetedTextPattern.String(), `(?m)^`) + `|[\s.,]`)
+
+type CardCoverage struct {
+	JsonCardId string
+	Name       string
+	Count      int // How many copies, e.g. in the decklist.
+	Coverage   int // COVERAGE_*
+	Reason     string
+}
+
+// Works out how well we simulate the given card.
+func getCardCoverage(jsonId string) CardCoverage {
+	jsonCard := GlobalCardJsonData[jsonId]
+	result := CardCoverage{JsonCardId: jsonId, Name: jsonCard.Name}
+	switch jsonCard.Type {
+	case "Minion", "Weapon", "Spell", "Hero Power":
+	default:
+		result.Coverage = COVERAGE_UNSUPPORTED
+		result.Reason = fmt.Sprintf("%v cards are never played", jsonCard.Type)
+		return result
+	}
+	if hasCardImplementation(jsonId) {
+		result.Coverage = COVERAGE_SIMULATED
+		return result
+	}
+	unknown := make([]string, 0)
+	for _, mechanic := range jsonCard.Mechanics {
+		if !keywordMechanics[mechanic] {
+			unknown = append(unknown, mechanic)
+		}
+	}
+	remainingText := keywordTextPattern.ReplaceAllString(jsonCard.Text, "")
+	switch {
+	case jsonCard.Type == "Spell" || jsonCard.Type == "Hero Power":
+		// getPlayCardTargetFilter won't let us play it.
+		result.Coverage = COVERAGE_UNSUPPORTED
+		result.Reason = fmt.Sprintf("%v with no known effect", strings.ToLower(jsonCard.Type))
+	case len(unknown) > 0:
+		result.Coverage = COVERAGE_VANILLA_ONLY
+		result.Reason = strings.Join(unknown, ", ")
+	case remainingText != "":
+		result.Coverage = COVERAGE_VANILLA_ONLY
+		result.Reason = fmt.Sprintf("%q", htmlTagPattern.ReplaceAllString(jsonCard.Text, ""))
+	default:
+		result.Coverage = COVERAGE_SIMULATED
+	}
+	return result
+}
+
+// Does specialcases.go (or a file of effects) know what this card does?
+func hasCardImplementation(jsonId string) bool {
+	_, played := GlobalCardPlayedActions[jsonId]
+	_, deathrattle := GlobalDeathrattleActions[jsonId]
+	_, trigger := GlobalTriggerHandlers[jsonId]
+	_, aura := adjacencyAttackAuras[jsonId]
+	return played || deathrattle || trigger || aura
+}
+
+// The coverage of each distinct card in `jsonIds`, worst first, then by name.
+func GetCoverage(jsonIds []string) []CardCoverage {
+	counts := make(map[string]int)
+	for _, jsonId := range jsonIds {
+		counts[jsonId] += 1
+	}
+	result := make([]CardCoverage, 0, len(counts))
+	for jsonId, count := range counts {
+		coverage := getCardCoverage(jsonId)
+		coverage.Count = count
+		result = append(result, coverage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Coverage != b.Coverage {
+			return a.Coverage > b.Coverage
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.JsonCardId < b.JsonCardId
+	})
+	return result
+}
+
+// The playable cards in a set (case insensitive), only the collectible ones
+// if the card data says which those are.
+func getSetCardIds(set string) []string {
+	result := make([]string, 0)
+	anyCollectible := false
+	for _, jsonCard := range GlobalCardJsonData {
+		if strings.EqualFold(jsonCard.Set, set) && jsonCard.Collectible {
+			anyCollectible = true
+			break
+		}
+	}
+	for jsonId, jsonCard := range GlobalCardJsonData {
+		if !strings.EqualFold(jsonCard.Set, set) || (anyCollectible && !jsonCard.Collectible) {
+			continue
+		}
+		switch jsonCard.Type {
+		case "Minion", "Weapon", "Spell":
+			result = append(result, jsonId)
+		}
+	}
+	return result
+}
+
+// `hearthstone-helper coverage -deck mydeck.txt` or `-set Classic`
+func coverageMain(args []string) int {
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	deck := flags.String("deck", "", "A decklist: a deck code, or a file with a deck code or one card per line.")
+	set := flags.String("set", "", "Or instead, the name of a card set, e.g. Classic.")
+	cards := addCardsFlag(flags)
+	effects := addEffectsFlag(flags)
+	flags.Parse(args)
+	if !loadCardDatabase(*cards) || !loadCardEffects(*effects) {
+		return 1
+	}
+
+	var jsonIds []string
+	switch {
+	case *deck != "":
+		var err error
+		if jsonIds, err = LoadDeckList(*deck); err != nil {
+			fmt.Println("ERROR: Cannot load decklist:", err.Error())
+			return 1
+		}
+	case *set != "":
+		if jsonIds = getSetCardIds(*set); len(jsonIds) == 0 {
+			fmt.Printf("ERROR: No cards in set %q\n", *set)
+			return 1
+		}
+	default:
+		fmt.Println("ERROR: Give either -deck or -set.")
+		return 1
+	}
+
+	totals := make([]int, len(coverageNames))
+	for _, coverage := range GetCoverage(jsonIds) {
+		line := fmt.Sprintf("%-12v %vx %v (%v)", coverageNames[coverage.Coverage], coverage.Count, coverage.Name, coverage.JsonCardId)
+		if coverage.Reason != "" {
+			line += ": " + coverage.Reason
+		}
+		fmt.Println(line)
+		totals[coverage.Coverage] += coverage.Count
+	}
+	fmt.Printf("INFO: %v simulated, %v vanilla only, %v unsupported.\n",
+		totals[COVERAGE_SIMULATED], totals[COVERAGE_VANILLA_ONLY], totals[COVERAGE_UNSUPPORTED])
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCardCoverage(t *testing.T) {
+	for jsonId, expected := range map[string]int{
+		"CS2_182":  COVERAGE_SIMULATED,    // Chillwind Yeti: no text at all.
+		"CS1_042":  COVERAGE_SIMULATED,    // Goldshire Footman: just Taunt.
+		"CS2_124":  COVERAGE_SIMULATED,    // Wolfrider: just Charge.
+		"CS2_142":  COVERAGE_SIMULATED,    // Kobold Geomancer: Spell Damage.
+		"NEW1_023": COVERAGE_SIMULATED,    // Faerie Dragon: can't be targeted.
+		"EX1_604":  COVERAGE_SIMULATED,    // Frothing Berserker: a trigger.
+		"CS2_029":  COVERAGE_SIMULATED,    // Fireball
+		"FP1_024":  COVERAGE_SIMULATED,    // Unstable Ghoul: Taunt and a deathrattle.
+		"EX1_110":  COVERAGE_VANILLA_ONLY, // Cairne Bloodhoof: an unknown deathrattle.
+		"EX1_006":  COVERAGE_VANILLA_ONLY, // Alarm-o-Bot: text without mechanics.
+		"EX1_302":  COVERAGE_UNSUPPORTED,  // Mortal Coil
+		"CS2_102":  COVERAGE_SIMULATED,    // Armor Up!
+		"CS2_049":  COVERAGE_UNSUPPORTED,  // Totemic Call
+	} {
+		if coverage := getCardCoverage(jsonId); coverage.Coverage != expected {
+			t.Errorf("%v: expected %v, got %v (%v)", coverage.Name, coverageNames[expected], coverageNames[coverage.Coverage], coverage.Reason)
+		}
+	}
+}
+
+func TestGetCoverage(t *testing.T) {
+	result := GetCoverage([]string{"CS2_182", "EX1_302", "CS2_182", "EX1_110"})
+	if len(result) != 3 {
+		t.Fatal("Expected one entry per distinct card, got", result)
+	}
+	if result[0].JsonCardId != "EX1_302" || result[1].JsonCardId != "EX1_110" || result[2].JsonCardId != "CS2_182" || result[2].Count != 2 {
+		t.Error("Expected the worst covered cards first, got", result)
+	}
+	if result[1].Reason != "Deathrattle" {
+		t.Error("Expected Cairne's deathrattle to be the reason, got", result[1].Reason)
+	}
+
+	classic := getSetCardIds("classic")
+	if len(classic) < 200 {
+		t.Error("Expected the collectible Classic cards, got", len(classic))
+	}
+	for _, jsonId := range classic {
+		if !GlobalCardJsonData[jsonId].Collectible {
+			t.Error("Uncollectible card in set:", jsonId)
+		}
+	}
+}
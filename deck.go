@@ -0,0 +1,348 @@
+// Our deck: reading our decklist, and drawing from it in hypothetical lines.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Most cards a hand can hold. Anything drawn beyond this is burned.
+const MAX_HAND_SIZE = 10
+
+// Most cards a decklist may have. Decks are 30 cards, or 40 with Prince
+// Renathal; anything much bigger is a garbled (or hostile) decklist.
+const MAX_DECK_SIZE = 40
+
+// Sets our full decklist (one JsonCardId per copy) and works out
+// RemainingDeck from it. nil means we don't know our deck.
+func (gs *GameState) SetDeckList(jsonIds []string) {
+	gs.DeckList = jsonIds
+	gs.updateRemainingDeck()
+}
+
+// RemainingDeck is DeckList minus the cards we've seen leave our deck, i.e.
+// our cards anywhere else that weren't created by another card. This works
+// it out from scratch; after that the parser keeps it up to date through
+// takeFromRemainingDeck, and hypothetical draws update it themselves.
+func (gs *GameState) updateRemainingDeck() {
+	for _, card := range gs.CardsById {
+		card.TakenFromDeck = ""
+	}
+	if gs.DeckList == nil {
+		gs.RemainingDeck = nil
+		return
+	}
+	gs.RemainingDeck = make(map[string]int32)
+	for _, jsonId := range gs.DeckList {
+		gs.RemainingDeck[jsonId] += 1
+	}
+	for _, card := range gs.CardsById {
+		gs.takeFromRemainingDeck(card)
+	}
+}
+
+// Takes `card` out of RemainingDeck the first time we see it outside our
+// deck. Whether it's ours goes by who controlled it then, so a card the
+// opponent steals later stays out. Puts it back if the log then tells us
+// another card created it.
+func (gs *GameState) takeFromRemainingDeck(card *Card) {
+	if gs.RemainingDeck == nil {
+		return
+	}
+	if card.TakenFromDeck != "" {
+		if card.CreatorId != 0 {
+			gs.RemainingDeck[card.TakenFromDeck] += 1
+			card.TakenFromDeck = ""
+		}
+		return
+	}
+	if card.CreatorId != 0 || card.JsonCardId == "" || card.ZoneTag == "DECK" || strings.HasSuffix(card.Zone, " DECK") {
+		return
+	}
+	if card.Controller != 0 {
+		if card.Controller != gs.LocalPlayerId || card.ZoneTag == "" {
+			return
+		}
+	} else if getSide(card.Zone) != "FRIENDLY" {
+		// Hypothetical cards have no Controller.
+		return
+	}
+	if gs.RemainingDeck[card.JsonCardId] > 0 {
+		gs.RemainingDeck[card.JsonCardId] -= 1
+		card.TakenFromDeck = card.JsonCardId
+	}
+}
+
+// How many cards are left in our deck, if we know.
+func (gs *GameState) remainingDeckSize() int32 {
+	var result int32
+	for _, count := range gs.RemainingDeck {
+		result += count
+	}
+	return result
+}
+
+// Card effects call this rather than picking a card themselves, so that the
+// solver can consider every card we might draw. See expandDraws.
+func (gs *GameState) drawCards(n int32) {
+	gs.PendingDraws += n
+}
+
+// Moves a card with the given JsonCardId ("" if we don't know what it is)
+// from our deck to our hand, or to the graveyard if the hand is full.
+func (gs *GameState) drawCard(jsonId string) *Card {
+	var card *Card
+	for deckCard := range gs.CardsByZone["FRIENDLY DECK"] {
+		if deckCard.JsonCardId == jsonId || deckCard.JsonCardId == "" {
+			if card == nil || card.InstanceId > deckCard.InstanceId {
+				card = deckCard
+			}
+		}
+	}
+	if card == nil {
+		card = gs.getOrCreateCard(jsonId, gs.HighestCardId+1)
+	} else if card.JsonCardId != jsonId {
+		card.changeJsonCardId(jsonId)
+	}
+	if gs.RemainingDeck[jsonId] > 0 {
+		gs.RemainingDeck[jsonId] -= 1
+		card.TakenFromDeck = jsonId
+	}
+	if len(gs.CardsByZone["FRIENDLY HAND"]) >= MAX_HAND_SIZE {
+		gs.moveCard(card, "FRIENDLY GRAVEYARD")
+		return card
+	}
+	gs.moveCard(card, "FRIENDLY HAND")
+	gs.fireTrigger(&TriggerContext{Event: EVENT_CARD_DRAWN, Subject: card})
+	return card
+}
+
+// Resolves the first of a node's PendingDraws, sending one child per
+// distinct card we might draw, weighted by how likely it is.
+// TODO: Fatigue, once we track how much of it there has been.
+func expandDraws(node *DecisionTreeNode, workChan chan<- *DecisionTreeNode) {
+	total := node.Gs.remainingDeckSize()
+	if total == 0 {
+		// Either we don't know the deck or it's empty. Either way there is
+		// nothing useful to draw.
+		child := node.Gs.DeepCopy()
+		child.PendingDraws -= 1
+		if node.Gs.RemainingDeck == nil {
+			child.drawCard("")
+		}
+		workChan <- &DecisionTreeNode{Gs: child, Moves: node.Moves, SuccessProbability: node.SuccessProbability, Hash: hashNode(child, node.Moves)}
+		return
+	}
+	jsonIds := make([]string, 0, len(node.Gs.RemainingDeck))
+	for jsonId, count := range node.Gs.RemainingDeck {
+		if count > 0 {
+			jsonIds = append(jsonIds, jsonId)
+		}
+	}
+	sort.Strings(jsonIds)
+	for _, jsonId := range jsonIds {
+		child := node.Gs.DeepCopy()
+		child.PendingDraws -= 1
+		probability := float32(node.Gs.RemainingDeck[jsonId]) / float32(total)
+		card := child.drawCard(jsonId)
+		newMoves := make([]*MoveParams, len(node.Moves)+1)
+		copy(newMoves, node.Moves)
+		newMoves[len(newMoves)-1] = &MoveParams{
+			CardOne:     card,
+			Description: fmt.Sprintf("Draw %v", card.Name),
+			Chance:      true,
+		}
+		workChan <- &DecisionTreeNode{
+			Gs:                 child,
+			Moves:              newMoves,
+			SuccessProbability: node.SuccessProbability * probability,
+			Hash:               hashNode(child, newMoves),
+		}
+	}
+}
+
+// The cards a line relies on drawing, in order.
+func getDraws(node *DecisionTreeNode) []string {
+	result := make([]string, 0)
+	for _, move := range node.Moves {
+		if move.Chance {
+			result = append(result, move.CardOne.Name)
+		}
+	}
+	return result
+}
+
+// Adds up the chance of winning with each line of moves that leads to a draw,
+// since any of several draws may win. E.g. if Moonfire, Fireball or Frostbolt
+// all win after Arcane Intellect, that line wins 3 times in 30, not 1.
+type LineChances struct {
+	// By the moves before the first draw, then by the draws made, the chance
+	// of those draws.
+	outcomes map[string]map[string]float32
+}
+
+func NewLineChances() *LineChances {
+	return &LineChances{outcomes: make(map[string]map[string]float32)}
+}
+
+// Counts `solution`, and returns the chance that some draw wins after the
+// same moves as it, from every solution counted so far.
+func (lc *LineChances) Add(solution *DecisionTreeNode) float32 {
+	firstDraw := len(solution.Moves)
+	draws := make([]string, 0)
+	for i, move := range solution.Moves {
+		if move.Chance {
+			if len(draws) == 0 {
+				firstDraw = i
+			}
+			draws = append(draws, move.CardOne.JsonCardId)
+		}
+	}
+	if len(draws) == 0 {
+		return solution.SuccessProbability
+	}
+	line := getSolutionKey(&DecisionTreeNode{Moves: solution.Moves[:firstDraw]})
+	if lc.outcomes[line] == nil {
+		lc.outcomes[line] = make(map[string]float32)
+	}
+	lc.outcomes[line][strings.Join(draws, "\n")+"\n"] = solution.SuccessProbability
+
+	// Different sequences of draws can't both happen, unless one starts with
+	// the other, in which case the shorter one already covers the longer.
+	var total float32
+	for outcome, probability := range lc.outcomes[line] {
+		covered := false
+		for other := range lc.outcomes[line] {
+			if other != outcome && strings.HasPrefix(outcome, other) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			total += probability
+		}
+	}
+	return total
+}
+
+// Reads a decklist given on the command line: a deckstring, or the path to a
+// file holding either a deckstring or a plain text list (see ParseDeckList).
+func LoadDeckList(codeOrPath string) ([]string, error) {
+	if data, err := os.ReadFile(codeOrPath); err == nil {
+		return ParseDeckList(string(data))
+	}
+	return DecodeDeckstring(codeOrPath)
+}
+
+// A plain text decklist line: an optional count ("2", "2x"), an optional
+// mana cost in brackets as the game's export has it, then a card name or id.
+var deckListLinePattern = regexp.MustCompile(`^(?:(\d+)x?\s+)?(?:\(\d+\)\s+)?(.+?)\s*$`)
+
+// Parses a decklist as exported from the game (comments, with the deckstring
+// on a line of its own), or one card per line with an optional count, e.g.
+// "2 Fiery War Axe" or "1x EX1_604".
+func ParseDeckList(text string) ([]string, error) {
+	result := make([]string, 0, 30)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// The game's export lists the cards as comments, but the
+			// deckstring says the same thing.
+			continue
+		}
+		if jsonIds, err := DecodeDeckstring(line); err == nil {
+			return jsonIds, nil
+		}
+		match := deckListLinePattern.FindStringSubmatch(line)
+		count := 1
+		if match[1] != "" {
+			count, _ = strconv.Atoi(match[1])
+		}
+		jsonId, ok := findJsonCardId(match[2])
+		if !ok {
+			return nil, fmt.Errorf("unknown card %q", match[2])
+		}
+		if count > MAX_DECK_SIZE-len(result) {
+			return nil, fmt.Errorf("more than %v cards in decklist", MAX_DECK_SIZE)
+		}
+		for i := 0; i < count; i++ {
+			result = append(result, jsonId)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no cards in decklist")
+	}
+	return result, nil
+}
+
+// Decodes a deckstring: base64 of varints, being a zero, the version, the
+// format, the heroes, then the dbfIds of the cards with one copy, with two
+// copies, and with some other number of copies (each followed by the count).
+func DecodeDeckstring(code string) ([]string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(code))
+	if err != nil {
+		return nil, fmt.Errorf("not a deckstring: %v", err)
+	}
+	r := bytes.NewReader(data)
+	readVarint := func() uint64 {
+		if err != nil {
+			return 0
+		}
+		var value uint64
+		value, err = binary.ReadUvarint(r)
+		return value
+	}
+	if readVarint() != 0 || readVarint() != 1 {
+		if err == nil {
+			err = fmt.Errorf("unsupported deckstring version")
+		}
+		return nil, err
+	}
+	readVarint() // Format: wild or standard.
+	numHeroes := readVarint()
+	for i := uint64(0); i < numHeroes && err == nil; i++ {
+		readVarint()
+	}
+	result := make([]string, 0, 30)
+	addCards := func(dbfId uint64, count uint64) {
+		jsonId, ok := GlobalCardIdsByDbfId[int32(dbfId)]
+		if !ok && err == nil {
+			err = fmt.Errorf("unknown dbfId %v", dbfId)
+		}
+		if count > uint64(MAX_DECK_SIZE-len(result)) && err == nil {
+			err = fmt.Errorf("more than %v cards", MAX_DECK_SIZE)
+		}
+		if err != nil {
+			return
+		}
+		for i := uint64(0); i < count; i++ {
+			result = append(result, jsonId)
+		}
+	}
+	for copies := uint64(1); copies <= 2; copies++ {
+		numCards := readVarint()
+		for i := uint64(0); i < numCards && err == nil; i++ {
+			addCards(readVarint(), copies)
+		}
+	}
+	numCards := readVarint()
+	for i := uint64(0); i < numCards && err == nil; i++ {
+		dbfId := readVarint()
+		addCards(dbfId, readVarint())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad deckstring: %v", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestParseDeckList(t *testing.T) {
+	deckList, err := ParseDeckList("### My Warrior\n# 2x (2) Fiery War Axe\n\n2 Fiery War Axe\n1x EX1_604\nwhirlwind\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"CS2_106", "CS2_106", "EX1_604", "EX1_400"}
+	if len(deckList) != len(expected) {
+		t.Fatal("Wrong decklist:", deckList)
+	}
+	for i := range expected {
+		if deckList[i] != expected[i] {
+			t.Error("Wrong decklist:", deckList)
+		}
+	}
+	if _, err := ParseDeckList("2 Not A Real Card"); err == nil {
+		t.Error("Expected an error for an unknown card")
+	}
+	if _, err := ParseDeckList("999999999 Fiery War Axe"); err == nil {
+		t.Error("Expected an error for too many cards")
+	}
+}
+
+func TestDecodeDeckstring(t *testing.T) {
+	// AllSets.json has no dbfIds, so make some up.
+	GlobalCardIdsByDbfId[1] = "EX1_604"
+	GlobalCardIdsByDbfId[2] = "CS2_106"
+	GlobalCardIdsByDbfId[300] = "EX1_400"
+	defer func() {
+		delete(GlobalCardIdsByDbfId, 1)
+		delete(GlobalCardIdsByDbfId, 2)
+		delete(GlobalCardIdsByDbfId, 300)
+	}()
+	// Version 1, wild, one hero, then one single, one pair, and three of dbfId 300.
+	code := base64.StdEncoding.EncodeToString([]byte{0, 1, 1, 1, 7, 1, 1, 1, 2, 1, 0xac, 0x02, 3})
+	deckList, err := ParseDeckList("# Some comment\n" + code + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, jsonId := range deckList {
+		counts[jsonId] += 1
+	}
+	if len(deckList) != 6 || counts["EX1_604"] != 1 || counts["CS2_106"] != 2 || counts["EX1_400"] != 3 {
+		t.Error("Wrong decklist:", deckList)
+	}
+	if _, err := DecodeDeckstring(base64.StdEncoding.EncodeToString([]byte{0, 1, 1, 0, 1, 99, 0, 0})); err == nil {
+		t.Error("Expected an error for an unknown dbfId")
+	}
+	// One card with 2^63 copies.
+	huge := []byte{0, 1, 1, 1, 7, 0, 0, 1, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}
+	if _, err := DecodeDeckstring(base64.StdEncoding.EncodeToString(huge)); err == nil {
+		t.Error("Expected an error for too many copies")
+	}
+	// 2^63 heroes, and nothing after them.
+	if _, err := DecodeDeckstring(base64.StdEncoding.EncodeToString([]byte{0, 1, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f})); err == nil {
+		t.Error("Expected an error for a truncated deckstring")
+	}
+}
+
+func TestRemainingDeck(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	gs.SetDeckList([]string{"EX1_604", "EX1_604", "EX1_400"})
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - CREATE_GAME",
+		"[Power] GameState.DebugPrintPower() -     Player EntityID=2 PlayerID=1 GameAccountId=[hi=1 lo=1]",
+		"[Power] GameState.DebugPrintPower() -     Player EntityID=3 PlayerID=2 GameAccountId=[hi=1 lo=2]",
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=10 CardID=",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=DECK",
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=11 CardID=EX1_604",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=HAND",
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=12 CardID=EX1_400",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=CREATOR value=11",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=HAND",
+	})
+	if gs.DeckList == nil || gs.RemainingDeck["EX1_604"] != 1 || gs.RemainingDeck["EX1_400"] != 1 {
+		t.Error("Expected one Frothing Berserker drawn and the created Whirlwind ignored:", gs.RemainingDeck)
+	}
+
+	// Our Berserker gets Mind Controlled, and our Whirlwind turns out to
+	// have been made by the Berserker after all.
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Frothing Berserker id=11 zone=HAND zonePos=1 cardId=EX1_604 player=1] tag=ZONE value=PLAY",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Frothing Berserker id=11 zone=PLAY zonePos=1 cardId=EX1_604 player=1] tag=CONTROLLER value=2",
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=13 CardID=EX1_400",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=HAND",
+		"[Power] GameState.DebugPrintPower() -     tag=CREATOR value=11",
+	})
+	if gs.CardsById[11].Zone != "OPPOSING PLAY" {
+		t.Fatal("Expected the Berserker to change sides:", gs.CardsById[11])
+	}
+	if gs.RemainingDeck["EX1_604"] != 1 || gs.RemainingDeck["EX1_400"] != 1 {
+		t.Error("Expected the stolen Berserker to stay out of the deck and the created Whirlwind ignored:", gs.RemainingDeck)
+	}
+}
+
+func TestRemainingDeckAfterReveal(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	gs.SetDeckList([]string{"EX1_604", "EX1_604"})
+	gs.setLocalPlayer(1)
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=20 CardID=",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=DECK",
+		"[Power] GameState.DebugPrintPower() - SHOW_ENTITY - Updating Entity=[id=20 cardId= type=INVALID zone=DECK zonePos=0 player=1] CardID=EX1_604",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=HAND",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE_POSITION value=1",
+		"[Power] GameState.DebugPrintPower() - CHANGE_ENTITY - Updating Entity=[name=Frothing Berserker id=20 zone=HAND zonePos=1 cardId=EX1_604 player=1] CardID=EX1_066",
+		"[Power] GameState.DebugPrintPower() -     tag=COST value=1",
+	})
+	card := gs.CardsById[20]
+	if card.JsonCardId != "EX1_066" || card.Controller != 1 || card.ZoneTag != "HAND" || card.ZonePosition != 1 || card.Zone != "FRIENDLY HAND" {
+		t.Error("Expected the transformed card to stay where it was:", card)
+	}
+	if gs.RemainingDeck["EX1_604"] != 1 || gs.RemainingDeck["EX1_066"] != 0 {
+		t.Error("Expected the card to leave the deck only once:", gs.RemainingDeck)
+	}
+}
+
+func TestLineChances(t *testing.T) {
+	draw := func(jsonId string) *MoveParams {
+		return &MoveParams{CardOne: &Card{JsonCardId: jsonId}, Description: "Draw " + jsonId, Chance: true}
+	}
+	intellect := &MoveParams{Description: "Cast Arcane Intellect"}
+	moonfire := &MoveParams{Description: "Cast Moonfire"}
+	lineChances := NewLineChances()
+	lineChances.Add(&DecisionTreeNode{Moves: []*MoveParams{intellect, draw("CS2_008"), moonfire}, SuccessProbability: 0.1})
+	lineChances.Add(&DecisionTreeNode{Moves: []*MoveParams{intellect, draw("CS2_029"), moonfire}, SuccessProbability: 0.1})
+	// Already covered by drawing CS2_008 first.
+	lineChances.Add(&DecisionTreeNode{Moves: []*MoveParams{intellect, draw("CS2_008"), draw("CS2_024")}, SuccessProbability: 0.05})
+	total := lineChances.Add(&DecisionTreeNode{Moves: []*MoveParams{intellect, draw("CS2_029"), moonfire, moonfire}, SuccessProbability: 0.1})
+	if total < 0.199 || total > 0.201 {
+		t.Error("Expected the two winning draws to add up to 20%, got", total)
+	}
+	other := lineChances.Add(&DecisionTreeNode{Moves: []*MoveParams{moonfire, intellect, draw("CS2_008")}, SuccessProbability: 0.1})
+	if other != 0.1 {
+		t.Error("Expected a different line to be counted separately, got", other)
+	}
+}
@@ -0,0 +1,303 @@
+// Card behaviour described as data rather than as Go in specialcases.go, so
+// that cards can be added (and reviewed) without recompiling. A file of
+// effects maps JsonCardIds to CardEffects, e.g.
+//
+//	{
+//	  "CS2_029": {"name": "Fireball", "target": "any character",
+//	              "play": [{"effect": "damage", "amount": 6, "to": "target"}]},
+//	  "EX1_556": {"name": "Harvest Golem",
+//	              "deathrattle": [{"effect": "summon", "card": "skele21"}]}
+//	}
+//
+// See testdata/effects.json for more, including most of specialcases.go.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Effects to load when no path is given, if the file exists.
+const DEFAULT_EFFECTS_PATH = "effects.json"
+
+// What one card does. Cards here replace any Go implementation of the same
+// card.
+type CardEffects struct {
+	Name        string       `json:"name"`   // Only for people reading the file.
+	Target      string       `json:"target"` // A key of effectTargetFilters, or empty if the card takes no target.
+	Play        []EffectStep `json:"play"`   // The battlecry, or what the spell does.
+	Deathrattle []EffectStep `json:"deathrattle"`
+}
+
+// One thing an effect does, in order, to each of the characters `To` selects.
+type EffectStep struct {
+	Effect string `json:"effect"` // A key of effectPrimitives.
+	To     string `json:"to"`     // A key of effectSelectors, if the effect needs one.
+	If     string `json:"if"`     // Optional. A key of effectConditions.
+	Amount int32  `json:"amount"` // Damage, armor, cards to draw or minions to summon.
+	Attack int32  `json:"attack"` // For buffs.
+	Health int32  `json:"health"` // For buffs.
+	Taunt  bool   `json:"taunt"`  // For buffs.
+	Card   string `json:"card"`   // The JsonCardId to summon.
+}
+
+// Valid values for CardEffects.Target.
+var effectTargetFilters = map[string]func(*Card) bool{
+	"none":                 func(card *Card) bool { return card == nil },
+	"any minion":           targetAnyMinion,
+	"enemy minion":         targetEnemyMinion,
+	"damaged enemy minion": func(card *Card) bool { return targetEnemyMinion(card) && card.Damage > 0 },
+	"any character":        targetAnyCharacter,
+	"enemy character":      targetEnemyCharacter,
+}
+
+// Valid values for EffectStep.To. "friendly" and "enemy" are from the point
+// of view of the card with the effect.
+var effectSelectors = map[string]func(gs *GameState, params *MoveParams) []*Card{
+	"target": func(gs *GameState, params *MoveParams) []*Card {
+		if params.CardTwo == nil {
+			return nil
+		}
+		return []*Card{params.CardTwo}
+	},
+	"self": func(gs *GameState, params *MoveParams) []*Card {
+		return []*Card{params.CardOne}
+	},
+	"adjacent": func(gs *GameState, params *MoveParams) []*Card {
+		return gs.getAdjacentMinions(params.CardOne)
+	},
+	"target and adjacent": func(gs *GameState, params *MoveParams) []*Card {
+		if params.CardTwo == nil {
+			return nil
+		}
+		return append([]*Card{params.CardTwo}, gs.getAdjacentMinions(params.CardTwo)...)
+	},
+	"friendly hero": func(gs *GameState, params *MoveParams) []*Card {
+		return selectHero(gs, getSide(params.CardOne.Zone))
+	},
+	"enemy hero": func(gs *GameState, params *MoveParams) []*Card {
+		return selectHero(gs, getOtherSide(params.CardOne.Zone))
+	},
+	"friendly minions": func(gs *GameState, params *MoveParams) []*Card {
+		return gs.getOrderedZone(getSide(params.CardOne.Zone) + " PLAY")
+	},
+	"enemy minions": func(gs *GameState, params *MoveParams) []*Card {
+		return gs.getOrderedZone(getOtherSide(params.CardOne.Zone) + " PLAY")
+	},
+	"all minions": func(gs *GameState, params *MoveParams) []*Card {
+		return append(gs.getOrderedZone("FRIENDLY PLAY"), gs.getOrderedZone("OPPOSING PLAY")...)
+	},
+	"enemy characters": func(gs *GameState, params *MoveParams) []*Card {
+		side := getOtherSide(params.CardOne.Zone)
+		return append(selectHero(gs, side), gs.getOrderedZone(side+" PLAY")...)
+	},
+	"other enemy characters": func(gs *GameState, params *MoveParams) []*Card {
+		side := getOtherSide(params.CardOne.Zone)
+		result := make([]*Card, 0)
+		for _, character := range append(selectHero(gs, side), gs.getOrderedZone(side+" PLAY")...) {
+			if character != params.CardTwo {
+				result = append(result, character)
+			}
+		}
+		return result
+	},
+	"all characters": func(gs *GameState, params *MoveParams) []*Card {
+		result := append(selectHero(gs, "FRIENDLY"), gs.getOrderedZone("FRIENDLY PLAY")...)
+		result = append(result, selectHero(gs, "OPPOSING")...)
+		return append(result, gs.getOrderedZone("OPPOSING PLAY")...)
+	},
+}
+
+// Valid values for EffectStep.If.
+var effectConditions = map[string]func(gs *GameState, params *MoveParams) bool{
+	"target frozen": func(gs *GameState, params *MoveParams) bool {
+		return params.CardTwo != nil && params.CardTwo.Frozen
+	},
+	"target not frozen": func(gs *GameState, params *MoveParams) bool {
+		return params.CardTwo != nil && !params.CardTwo.Frozen
+	},
+	"target survived": func(gs *GameState, params *MoveParams) bool {
+		return params.CardTwo != nil && !minionNeedsKilling(params.CardTwo)
+	},
+}
+
+// Valid values for EffectStep.Effect, and whether they need a `to`.
+var effectPrimitives = map[string]struct {
+	needsTargets bool
+	apply        func(gs *GameState, params *MoveParams, step *EffectStep, targets []*Card)
+}{
+	"damage": {true, func(gs *GameState, params *MoveParams, step *EffectStep, targets []*Card) {
+		for _, target := range targets {
+			gs.dealDamage(target, gs.getSpellDamage(params.CardOne, step.Amount))
+		}
+	}},
+	"buff": {true, func(gs *GameState, params *MoveParams, step *EffectStep, targets []*Card) {
+		for _, target := range targets {
+			target.Attack += step.Attack
+			target.Health += step.Health
+			target.Taunt = target.Taunt || step.Taunt
+		}
+	}},
+	"destroy": {true, func(gs *GameState, params *MoveParams, step *EffectStep, targets []*Card) {
+		for _, target := range targets {
+			target.PendingDestroy = true
+		}
+	}},
+	"freeze": {true, func(gs *GameState, params *MoveParams, step *EffectStep, targets []*Card) {
+		for _, target := range targets {
+			target.Frozen = true
+		}
+	}},
+	"armor": {true, func(gs *GameState, params *MoveParams, step *EffectStep, targets []*Card) {
+		for _, target := range targets {
+			target.Armor += step.Amount
+		}
+	}},
+	"draw": {false, func(gs *GameState, params *MoveParams, step *EffectStep, targets []*Card) {
+		// We don't know or care what the opponent draws.
+		if getSide(params.CardOne.Zone) == "FRIENDLY" {
+			gs.drawCards(step.Amount)
+		}
+	}},
+	"summon": {false, func(gs *GameState, params *MoveParams, step *EffectStep, targets []*Card) {
+		count := step.Amount
+		if count == 0 {
+			count = 1
+		}
+		gs.summonMinions(step.Card, getSide(params.CardOne.Zone)+" PLAY", int(count))
+	}},
+}
+
+func selectHero(gs *GameState, side string) []*Card {
+	if hero := getSingletonFromZone(gs, side+" PLAY (Hero)", false); hero != nil {
+		return []*Card{hero}
+	}
+	return nil
+}
+
+// The side opposite the one `zone` is on.
+func getOtherSide(zone string) string {
+	if getSide(zone) == "FRIENDLY" {
+		return "OPPOSING"
+	}
+	return "FRIENDLY"
+}
+
+// Reads and checks a file of effects. Anything we wouldn't know how to run
+// is an error, so that mistakes show up when loading rather than mid-game.
+func LoadCardEffects(path string) (map[string]*CardEffects, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var effects map[string]*CardEffects
+	if err := json.Unmarshal(data, &effects); err != nil {
+		return nil, fmt.Errorf("cannot parse %v: %v", path, err)
+	}
+	for jsonId, cardEffects := range effects {
+		if err := validateCardEffects(jsonId, cardEffects); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	return effects, nil
+}
+
+func validateCardEffects(jsonId string, cardEffects *CardEffects) error {
+	if _, ok := GlobalCardJsonData[jsonId]; !ok {
+		return fmt.Errorf("unknown card %v", jsonId)
+	}
+	if _, ok := effectTargetFilters[cardEffects.Target]; !ok && cardEffects.Target != "" {
+		return fmt.Errorf("%v: unknown target %q", jsonId, cardEffects.Target)
+	}
+	if cardEffects.Play == nil && cardEffects.Deathrattle == nil {
+		return fmt.Errorf("%v: no play or deathrattle effects", jsonId)
+	}
+	for _, step := range append(cardEffects.Play, cardEffects.Deathrattle...) {
+		primitive, ok := effectPrimitives[step.Effect]
+		if !ok {
+			return fmt.Errorf("%v: unknown effect %q", jsonId, step.Effect)
+		}
+		if _, ok := effectSelectors[step.To]; !ok && (step.To != "" || primitive.needsTargets) {
+			return fmt.Errorf("%v: %v effect with unknown `to` %q", jsonId, step.Effect, step.To)
+		}
+		if _, ok := effectConditions[step.If]; !ok && step.If != "" {
+			return fmt.Errorf("%v: unknown condition %q", jsonId, step.If)
+		}
+		if _, ok := GlobalCardJsonData[step.Card]; step.Effect == "summon" && !ok {
+			return fmt.Errorf("%v: cannot summon unknown card %q", jsonId, step.Card)
+		}
+	}
+	return nil
+}
+
+// Turns a list of steps into an action for GlobalCardPlayedActions or
+// GlobalDeathrattleActions. The steps must have been validated.
+func getEffectStepsAction(steps []EffectStep) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		for i := range steps {
+			step := &steps[i]
+			if step.If != "" && !effectConditions[step.If](gs, params) {
+				continue
+			}
+			var targets []*Card
+			if step.To != "" {
+				targets = effectSelectors[step.To](gs, params)
+			}
+			effectPrimitives[step.Effect].apply(gs, params, step, targets)
+		}
+	}
+}
+
+// Cards whose effects care where they are played, see placementMatters.
+var positionalEffectCards = map[string]bool{}
+
+// Makes the engine use the given effects, replacing any Go implementations.
+func registerCardEffects(effects map[string]*CardEffects) {
+	for jsonId, cardEffects := range effects {
+		delete(specialCardTargetFilters, jsonId)
+		delete(GlobalCardPlayedActions, jsonId)
+		delete(GlobalDeathrattleActions, jsonId)
+		delete(positionalEffectCards, jsonId)
+		if cardEffects.Target != "" {
+			specialCardTargetFilters[jsonId] = effectTargetFilters[cardEffects.Target]
+		}
+		if cardEffects.Play != nil {
+			GlobalCardPlayedActions[jsonId] = getEffectStepsAction(cardEffects.Play)
+		}
+		if cardEffects.Deathrattle != nil {
+			GlobalDeathrattleActions[jsonId] = getEffectStepsAction(cardEffects.Deathrattle)
+		}
+		for _, step := range cardEffects.Play {
+			if step.To == "adjacent" {
+				positionalEffectCards[jsonId] = true
+			}
+		}
+	}
+}
+
+// The -effects flag every command takes.
+func addEffectsFlag(flags *flag.FlagSet) *string {
+	return flags.String("effects", "", fmt.Sprintf("Optional. A file of card effects to add to (or replace) the built in ones. Defaults to %v, if it exists.", DEFAULT_EFFECTS_PATH))
+}
+
+// Loads and registers the effects for a command, or explains why we can't.
+// Call after loadCardDatabase.
+func loadCardEffects(path string) bool {
+	if path == "" {
+		if _, err := os.Stat(DEFAULT_EFFECTS_PATH); err != nil {
+			return true
+		}
+		path = DEFAULT_EFFECTS_PATH
+	}
+	effects, err := LoadCardEffects(path)
+	if err != nil {
+		fmt.Println("ERROR: Cannot load card effects:", err.Error())
+		return false
+	}
+	fmt.Printf("INFO: Loaded effects for %v cards from %v\n", len(effects), path)
+	registerCardEffects(effects)
+	return true
+}
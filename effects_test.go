@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A board with something for every kind of target: a damaged enemy, a
+// frozen one, and friends on both sides of where battlecries happen.
+func createEffectsTestState(jsonId string) (GameState, *Card) {
+	gs := createEmptyGameState()
+	gs.ManaMax = 10
+	gs.CreateNewMinion("CS2_182", "FRIENDLY PLAY") // Chillwind Yeti
+	gs.CreateNewMinion("CS2_172", "OPPOSING PLAY").Damage = 1
+	gs.CreateNewMinion("CS2_120", "OPPOSING PLAY").Frozen = true
+	gs.CreateNewMinion("CS2_142", "OPPOSING PLAY")
+	gs.CreateNewMinion("CS2_120", "OPPOSING PLAY").Health = 1
+	var card *Card
+	switch GlobalCardJsonData[jsonId].Type {
+	case "Spell":
+		card = gs.CreateNewMinion(jsonId, "FRIENDLY HAND")
+	default:
+		card = gs.CreateNewMinion(jsonId, "FRIENDLY PLAY")
+	}
+	gs.CreateNewMinion("CS2_120", "FRIENDLY PLAY")
+	return gs, card
+}
+
+// Runs `action` on a copy of `gs` and cleans up, returning the copy as JSON.
+func runEffectsTestAction(gs *GameState, action func(*GameState, *MoveParams), card *Card, target *Card) (string, int32) {
+	gs = gs.DeepCopy()
+	params := &MoveParams{CardOne: gs.CardsById[card.InstanceId]}
+	if target != nil {
+		params.CardTwo = gs.CardsById[target.InstanceId]
+	}
+	action(gs, params)
+	gs.cleanupState()
+	result, _ := json.Marshal(gs)
+	return string(result), gs.PendingDraws
+}
+
+// testdata/effects.json has cards we also implement in Go, which should
+// behave the same either way.
+func TestCardEffectsMatchGo(t *testing.T) {
+	effects, err := LoadCardEffects("testdata/effects.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for jsonId, cardEffects := range effects {
+		gs, card := createEffectsTestState(jsonId)
+		targets := []*Card{nil}
+		for _, zone := range []string{"FRIENDLY PLAY (Hero)", "FRIENDLY PLAY", "OPPOSING PLAY (Hero)", "OPPOSING PLAY"} {
+			targets = append(targets, gs.getOrderedZone(zone)...)
+		}
+		goFilter, ok := specialCardTargetFilters[jsonId]
+		if !ok {
+			goFilter = func(*Card) bool { return true }
+		}
+		effectFilter, ok := effectTargetFilters[cardEffects.Target]
+		if !ok {
+			effectFilter = func(*Card) bool { return true }
+		}
+		for steps, goActions := range map[*[]EffectStep]map[string]func(*GameState, *MoveParams){
+			&cardEffects.Play:        GlobalCardPlayedActions,
+			&cardEffects.Deathrattle: GlobalDeathrattleActions,
+		} {
+			goAction, ok := goActions[jsonId]
+			if *steps == nil || !ok {
+				// A card only the data knows about.
+				continue
+			}
+			for _, target := range targets {
+				if goFilter(target) != effectFilter(target) {
+					t.Errorf("%v: Go and effects disagree on whether %v is a target", cardEffects.Name, target)
+				}
+				if !goFilter(target) {
+					continue
+				}
+				goResult, goDraws := runEffectsTestAction(&gs, goAction, card, target)
+				effectResult, effectDraws := runEffectsTestAction(&gs, getEffectStepsAction(*steps), card, target)
+				if goResult != effectResult || goDraws != effectDraws {
+					t.Errorf("%v targeting %v: Go and effects give different results:\n%v\n%v", cardEffects.Name, target, goResult, effectResult)
+				}
+			}
+		}
+	}
+}
+
+func TestCardEffects(t *testing.T) {
+	effects, err := LoadCardEffects("testdata/effects.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, tidehunter := createEffectsTestState("EX1_506")
+	getEffectStepsAction(effects["EX1_506"].Play)(&gs, &MoveParams{CardOne: tidehunter})
+	if len(gs.CardsByZone["FRIENDLY PLAY"]) != 4 {
+		t.Error("Murloc Tidehunter should summon a Murloc Scout")
+	}
+
+	golem := gs.CreateNewMinion("EX1_556", "FRIENDLY PLAY")
+	golem.Damage = golem.Health
+	registerCardEffects(map[string]*CardEffects{"EX1_556": effects["EX1_556"]})
+	defer delete(GlobalDeathrattleActions, "EX1_556")
+	gs.cleanupState()
+	if len(gs.getOrderedZone("FRIENDLY PLAY")) != 5 || gs.getOrderedZone("FRIENDLY PLAY")[4].JsonCardId != "skele21" {
+		t.Error("Harvest Golem should leave a Damaged Golem behind")
+	}
+
+	registerCardEffects(map[string]*CardEffects{"EX1_093": effects["EX1_093"]})
+	if !positionalEffectCards["EX1_093"] {
+		t.Error("Buffing adjacent minions should make placement matter")
+	}
+	delete(positionalEffectCards, "EX1_093")
+}
+
+func TestLoadCardEffectsErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, bad := range []string{
+		`{"EX1_603": {"play": [{"effect": "damage", "amount": 1, "to": "target"}]`,
+		`{"NOT_A_CARD": {"play": [{"effect": "draw", "amount": 1}]}}`,
+		`{"EX1_603": {}}`,
+		`{"EX1_603": {"target": "anything", "play": [{"effect": "draw", "amount": 1}]}}`,
+		`{"EX1_603": {"play": [{"effect": "explode", "to": "target"}]}}`,
+		`{"EX1_603": {"play": [{"effect": "damage", "amount": 1}]}}`,
+		`{"EX1_603": {"play": [{"effect": "damage", "amount": 1, "to": "target", "if": "raining"}]}}`,
+		`{"EX1_603": {"play": [{"effect": "summon", "card": "NOT_A_CARD"}]}}`,
+	} {
+		path := filepath.Join(dir, "effects.json")
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadCardEffects(path); err == nil {
+			t.Error("Expected an error loading", bad)
+		} else if !strings.Contains(err.Error(), path) {
+			t.Error("Errors should say which file is wrong:", err)
+		}
+	}
+}
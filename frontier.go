@@ -0,0 +1,123 @@
+// The nodes the solver has yet to expand.
+
+package main
+
+import (
+	"container/heap"
+)
+
+// The DecisionTreeNodes waiting to be expanded, at most `limit` of them.
+//
+// High priority nodes (pending draws, or whatever the PruningOpts favour)
+// always go first. Otherwise, while there is room the search goes breadth
+// first, which finds short lines quickly and doesn't get stuck down one
+// hopeless branch. Once the frontier is half full it goes depth first
+// instead, which finishes off branches and so keeps memory in check. Among
+// nodes at the same depth, the ones closest to lethal go first.
+type Frontier struct {
+	byDepth []frontierItems // Indexed by len(node.Moves).
+	size    int
+	limit   int
+	nextSeq int
+}
+
+type frontierItem struct {
+	node         *DecisionTreeNode
+	highPriority bool
+	damageNeeded int32
+	seq          int // Breaks ties in the order nodes were pushed.
+}
+
+func NewFrontier(limit int) *Frontier {
+	return &Frontier{byDepth: make([]frontierItems, 0), limit: limit}
+}
+
+func (f *Frontier) Len() int {
+	return f.size
+}
+
+// Adds `node` unless the frontier is full, and reports whether it did.
+func (f *Frontier) Push(node *DecisionTreeNode, highPriority bool) bool {
+	if f.size >= f.limit {
+		return false
+	}
+	depth := len(node.Moves)
+	for len(f.byDepth) <= depth {
+		f.byDepth = append(f.byDepth, make(frontierItems, 0))
+	}
+	heap.Push(&f.byDepth[depth], &frontierItem{
+		node:         node,
+		highPriority: highPriority,
+		damageNeeded: damageStillNeeded(node.Gs),
+		seq:          f.nextSeq,
+	})
+	f.nextSeq += 1
+	f.size += 1
+	return true
+}
+
+// The best node, without removing it. nil when the frontier is empty.
+func (f *Frontier) Peek() *DecisionTreeNode {
+	if depth := f.bestDepth(); depth >= 0 {
+		return f.byDepth[depth][0].node
+	}
+	return nil
+}
+
+// Removes and returns the best node.
+func (f *Frontier) Pop() *DecisionTreeNode {
+	node := heap.Pop(&f.byDepth[f.bestDepth()]).(*frontierItem).node
+	f.size -= 1
+	return node
+}
+
+// Where the next node comes from, or -1 if there are none.
+func (f *Frontier) bestDepth() int {
+	depthFirst := f.size >= f.limit/2
+	best := -1
+	for depth, items := range f.byDepth {
+		if len(items) == 0 {
+			continue
+		}
+		if best < 0 {
+			best = depth
+		} else if items[0].highPriority != f.byDepth[best][0].highPriority {
+			if items[0].highPriority {
+				best = depth
+			}
+		} else if depthFirst {
+			best = depth
+		}
+	}
+	return best
+}
+
+// Implements heap.Interface.
+type frontierItems []*frontierItem
+
+func (items frontierItems) Len() int { return len(items) }
+
+func (items frontierItems) Less(i, j int) bool {
+	a, b := items[i], items[j]
+	if a.highPriority != b.highPriority {
+		return a.highPriority
+	}
+	if a.damageNeeded != b.damageNeeded {
+		return a.damageNeeded < b.damageNeeded
+	}
+	return a.seq < b.seq
+}
+
+func (items frontierItems) Swap(i, j int) { items[i], items[j] = items[j], items[i] }
+
+func (items *frontierItems) Push(x interface{}) {
+	*items = append(*items, x.(*frontierItem))
+}
+
+func (items *frontierItems) Pop() interface{} {
+	old := *items
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*items = old[:len(old)-1]
+	return item
+}
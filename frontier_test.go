@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFrontierOrder(t *testing.T) {
+	gs := createEmptyGameState()
+	nodeAtDepth := func(depth int) *DecisionTreeNode {
+		return &DecisionTreeNode{Gs: &gs, Moves: make([]*MoveParams, depth)}
+	}
+	shallow, deep, deeper, urgent := nodeAtDepth(1), nodeAtDepth(2), nodeAtDepth(3), nodeAtDepth(1)
+
+	frontier := NewFrontier(10)
+	frontier.Push(deep, false)
+	frontier.Push(shallow, false)
+	frontier.Push(deeper, false)
+	frontier.Push(urgent, true)
+	if node := frontier.Pop(); node != urgent {
+		t.Error("Expected high priority nodes first")
+	}
+	if node := frontier.Pop(); node != shallow {
+		t.Error("Expected breadth first while there is room")
+	}
+
+	frontier = NewFrontier(4)
+	frontier.Push(shallow, false)
+	frontier.Push(deeper, false)
+	frontier.Push(deep, false)
+	if node := frontier.Peek(); node != deeper {
+		t.Error("Expected depth first once half full")
+	}
+	frontier.Push(shallow, false)
+	if frontier.Push(shallow, false) || frontier.Len() != 4 {
+		t.Error("Expected a full frontier to refuse nodes")
+	}
+	for frontier.Len() > 0 {
+		frontier.Pop()
+	}
+	if frontier.Peek() != nil {
+		t.Error("Expected nothing left")
+	}
+}
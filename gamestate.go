@@ -2,7 +2,12 @@
 
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 // Who won this game?
 const (
@@ -19,6 +24,42 @@ type GameState struct {
 	ManaTemp      int32
 	HighestCardId int32
 	Winner        int32
+	Players       map[int32]*Player // By PlayerId.
+	LocalPlayerId int32             // PlayerId of the friendly side, 0 until we know it.
+
+	// Turn structure, from the GameEntity and player tags.
+	Turn            int32  // Counts both players' turns, starting from 1.
+	CurrentPlayerId int32  // PlayerId whose turn it is.
+	FirstPlayerId   int32  // PlayerId who went first.
+	Step            string // e.g. "MAIN_ACTION".
+	NextStep        string
+
+	HighestPlayOrder int32 // The last Card.PlayOrder handed out.
+
+	// Our decklist, one JsonCardId per copy. Kept by resetGameState, since it
+	// comes from the command line rather than the log. nil if we don't know it.
+	DeckList []string
+	// What is left in our deck, by JsonCardId. nil if we don't know our decklist.
+	RemainingDeck map[string]int32
+	// Cards the last move drew that are yet to be decided. See expandDraws.
+	PendingDraws int32
+
+	// What has happened so far this game. Not copied by DeepCopy.
+	Actions []*Action // Top-level action blocks, in order.
+
+	// Parser bookkeeping, not part of the game itself.
+	openBlock  func(tagName string, tagValue string) bool // Consumes the child tag lines of the current block.
+	openAction *Action                                    // Innermost BLOCK_START without its BLOCK_END yet.
+}
+
+// One of the two players in a game, as announced by CREATE_GAME.
+type Player struct {
+	EntityId      int32  `json:"entityId"`
+	PlayerId      int32  `json:"playerId"` // What CONTROLLER tags refer to.
+	Name          string `json:"name"`     // Battletag without the #1234, once we've worked it out.
+	GameAccountId string `json:"gameAccountId"`
+	CurrentPlayer bool   `json:"currentPlayer"`
+	PlayState     string `json:"playState"` // e.g. "PLAYING", "WON", "LOST".
 }
 
 // Can't just use deepcopy.Copy because of CardsByZone's pointer keys.
@@ -28,13 +69,28 @@ func (gs *GameState) DeepCopy() *GameState {
 	for id, cardPtr := range gs.CardsById {
 		cardCopy := *cardPtr
 		result.CardsById[id] = &cardCopy
-		result.moveCard(&cardCopy, cardCopy.Zone) // Populate CardsByZone
+		result.rezoneCard(&cardCopy, cardCopy.Zone) // Populate CardsByZone
 	}
 	result.ManaMax = gs.ManaMax
 	result.ManaUsed = gs.ManaUsed
 	result.ManaTemp = gs.ManaTemp
 	result.HighestCardId = gs.HighestCardId
+	result.HighestPlayOrder = gs.HighestPlayOrder
+	result.DeckList = gs.DeckList
+	if gs.RemainingDeck != nil {
+		result.RemainingDeck = make(map[string]int32, len(gs.RemainingDeck))
+		for jsonId, count := range gs.RemainingDeck {
+			result.RemainingDeck[jsonId] = count
+		}
+	}
+	result.PendingDraws = gs.PendingDraws
 	result.Winner = gs.Winner
+	result.LocalPlayerId = gs.LocalPlayerId
+	result.Turn = gs.Turn
+	result.CurrentPlayerId = gs.CurrentPlayerId
+	result.FirstPlayerId = gs.FirstPlayerId
+	result.Step = gs.Step
+	result.NextStep = gs.NextStep
 	return &result
 }
 
@@ -45,7 +101,170 @@ func (gs *GameState) resetGameState() {
 	gs.ManaUsed = 0
 	gs.ManaTemp = 0
 	gs.HighestCardId = 0
+	gs.HighestPlayOrder = 0
+	gs.updateRemainingDeck()
+	gs.PendingDraws = 0
 	gs.Winner = NO_VICTORY
+	gs.Players = make(map[int32]*Player)
+	gs.LocalPlayerId = 0
+	gs.Turn = 0
+	gs.CurrentPlayerId = 0
+	gs.FirstPlayerId = 0
+	gs.Step = ""
+	gs.NextStep = ""
+	gs.Actions = nil
+	gs.openBlock = nil
+	gs.openAction = nil
+}
+
+// Is it the local player's turn?
+func (gs *GameState) IsFriendlyTurn() bool {
+	return gs.LocalPlayerId != 0 && gs.CurrentPlayerId == gs.LocalPlayerId
+}
+
+// Can the local player act right now? This is when solving is useful.
+func (gs *GameState) IsFriendlyMainPhase() bool {
+	return gs.IsFriendlyTurn() && gs.Step == "MAIN_ACTION"
+}
+
+// A copy of the GameState seen from the opponent's side, as at the start
+// of their next turn: our turn ends, their minions and hero are ready to
+// attack, their hero power is ready, their turn starts, and their unknown
+// hand is set aside. Solving this answers "am I dead next turn?" from what
+// is on the board and their hero power.
+// TODO: Their mana isn't tracked, so they only get enough for the hero
+// power, and burn from hand isn't considered.
+func (gs *GameState) OpponentPerspective() *GameState {
+	result := gs.DeepCopy()
+	if hero := getSingletonFromZone(result, "FRIENDLY PLAY (Hero)", false); hero != nil {
+		result.fireTrigger(&TriggerContext{Event: EVENT_TURN_END, Subject: hero})
+	}
+	for _, card := range result.CardsById {
+		zone := card.Zone
+		switch {
+		case strings.HasPrefix(zone, "FRIENDLY "):
+			zone = "OPPOSING " + strings.TrimPrefix(zone, "FRIENDLY ")
+		case strings.HasPrefix(zone, "OPPOSING "):
+			zone = "FRIENDLY " + strings.TrimPrefix(zone, "OPPOSING ")
+			if zone == "FRIENDLY HAND" && card.JsonCardId == "" {
+				zone = "FRIENDLY DECK"
+			}
+			if zone == "FRIENDLY PLAY" || zone == "FRIENDLY PLAY (Hero)" || zone == "FRIENDLY PLAY (Hero Power)" {
+				card.Exhausted = false
+				card.NumAttacksThisTurn = 0
+			}
+		}
+		if zone != card.Zone {
+			result.rezoneCard(card, zone)
+		}
+	}
+	for playerId := range gs.Players {
+		if playerId != gs.LocalPlayerId {
+			result.LocalPlayerId = playerId
+		}
+	}
+	result.CurrentPlayerId = result.LocalPlayerId
+	result.DeckList = nil
+	result.RemainingDeck = nil
+	result.ManaMax = 0
+	result.ManaUsed = 0
+	result.ManaTemp = 0
+	if heroPower := getSingletonFromZone(result, "FRIENDLY PLAY (Hero Power)", false); heroPower != nil {
+		result.ManaMax = heroPower.Cost
+	}
+	if hero := getSingletonFromZone(result, "FRIENDLY PLAY (Hero)", false); hero != nil {
+		result.fireTrigger(&TriggerContext{Event: EVENT_TURN_START, Subject: hero})
+		if getSingletonFromZone(result, "OPPOSING PLAY (Hero)", false) != nil {
+			result.cleanupState()
+		}
+	}
+	return result
+}
+
+// Records which player is friendly, and sorts every card we already know
+// about into the right side's zones.
+func (gs *GameState) setLocalPlayer(playerId int32) {
+	if playerId == 0 || gs.LocalPlayerId != 0 {
+		return
+	}
+	gs.LocalPlayerId = playerId
+	fmt.Println("INFO: Local player is PlayerID", playerId)
+	for _, card := range gs.CardsById {
+		gs.updateZoneFromTags(card)
+		gs.takeFromRemainingDeck(card)
+	}
+}
+
+// Finds the player the log calls `name`, working out which player that is
+// if we haven't seen the name before. Returns nil if we can't tell yet.
+// tagName and tagValue are the tag change the name appeared with.
+func (gs *GameState) getPlayerByName(name string, tagName string, tagValue string) *Player {
+	var unnamed []*Player
+	for _, player := range gs.Players {
+		if player.Name == name {
+			return player
+		}
+		if player.Name == "" {
+			unnamed = append(unnamed, player)
+		}
+	}
+	var result *Player
+	switch {
+	case len(unnamed) == 1 && len(gs.Players) == 2:
+		// The other player already has a name.
+		result = unnamed[0]
+	case name == localUsername && gs.LocalPlayerId != 0:
+		result = gs.Players[gs.LocalPlayerId]
+	case tagName == "PLAYER_ID":
+		playerId, _ := strconv.ParseInt(tagValue, 10, 32)
+		result = gs.Players[int32(playerId)]
+	case tagName == "CURRENT_PLAYER":
+		// The turn is passing to (value=1) or from (value=0) this player, so
+		// they must be the one whose CURRENT_PLAYER is about to flip.
+		for _, player := range unnamed {
+			if player.CurrentPlayer != (tagValue == "1") {
+				if result != nil {
+					return nil
+				}
+				result = player
+			}
+		}
+	}
+	if result == nil || result.Name != "" {
+		return nil
+	}
+	result.Name = name
+	if name == localUsername {
+		gs.setLocalPlayer(result.PlayerId)
+	}
+	return result
+}
+
+// Moves the card to the zone named by its CONTROLLER and ZONE tags, e.g.
+// "OPPOSING PLAY" or "FRIENDLY PLAY (Weapon)", matching the names the [Zone]
+// log uses. Does nothing until we know enough to name the zone.
+func (gs *GameState) updateZoneFromTags(card *Card) {
+	if gs.LocalPlayerId == 0 || card.Controller == 0 || card.ZoneTag == "" {
+		return
+	}
+	side := "OPPOSING"
+	if card.Controller == gs.LocalPlayerId {
+		side = "FRIENDLY"
+	}
+	zone := side + " " + card.ZoneTag
+	if card.ZoneTag == "PLAY" {
+		switch card.Type {
+		case "Hero", "Hero Power", "Weapon":
+			zone = fmt.Sprintf("%v (%v)", zone, card.Type)
+		case "Minion":
+		default:
+			// Enchantments and the like aren't on the board.
+			return
+		}
+	}
+	if card.Zone != zone {
+		gs.moveCard(card, zone)
+	}
 }
 
 func (gs *GameState) getOrCreateCard(jsonCardId string, instanceId int32) *Card {
@@ -62,10 +281,65 @@ func (gs *GameState) getOrCreateCard(jsonCardId string, instanceId int32) *Card
 	return &result
 }
 
+// Turn this card into a fresh copy of a different json card, e.g. when a
+// hidden card is revealed or transformed. It keeps its InstanceId and Zone
+// so that CardsById and CardsByZone remain valid, and everything else the
+// log told us about where it is and where it came from.
+func (c *Card) changeJsonCardId(jsonCardId string) {
+	fresh := newCardFromJson(jsonCardId, c.InstanceId)
+	fresh.Zone = c.Zone
+	fresh.Controller = c.Controller
+	fresh.ZoneTag = c.ZoneTag
+	fresh.ZonePosition = c.ZonePosition
+	fresh.PlayOrder = c.PlayOrder
+	fresh.CreatorId = c.CreatorId
+	fresh.TakenFromDeck = c.TakenFromDeck
+	*c = fresh
+}
+
 // Update the GameState to note that the given card is in a new zone.
 // This function does not apply any logic like deathrattles, it simply
-// updates the maps on GameState and card.Zone.
+// updates the maps on GameState, card.Zone and the ZonePositions in the old
+// and new zones. The card goes to the right end of positional zones.
 func (gs *GameState) moveCard(card *Card, newZone string) {
+	gs.moveCardToPosition(card, newZone, 0)
+}
+
+// Like moveCard, but puts the card at the given 1-based position in a
+// positional zone, shifting the cards there to the right. Position 0 (or
+// anything past the end) means the right end.
+func (gs *GameState) moveCardToPosition(card *Card, newZone string, position int32) {
+	if isPositionalZone(card.Zone) && card.ZonePosition > 0 {
+		for other := range gs.CardsByZone[card.Zone] {
+			if other != card && other.ZonePosition > card.ZonePosition {
+				other.ZonePosition -= 1
+			}
+		}
+	}
+	if !isTriggerZone(card.Zone) && isTriggerZone(newZone) {
+		gs.HighestPlayOrder += 1
+		card.PlayOrder = gs.HighestPlayOrder
+	}
+	gs.rezoneCard(card, newZone)
+	card.ZonePosition = 0
+	if !isPositionalZone(newZone) {
+		return
+	}
+	numOthers := int32(len(gs.CardsByZone[newZone]) - 1)
+	if position <= 0 || position > numOthers+1 {
+		position = numOthers + 1
+	}
+	for other := range gs.CardsByZone[newZone] {
+		if other != card && other.ZonePosition >= position {
+			other.ZonePosition += 1
+		}
+	}
+	card.ZonePosition = position
+}
+
+// Moves the card between the CardsByZone sets without renumbering any
+// ZonePositions, e.g. when copying a GameState whose positions are already right.
+func (gs *GameState) rezoneCard(card *Card, newZone string) {
 	if oldZoneCards, ok := gs.CardsByZone[card.Zone]; ok {
 		if _, ok := oldZoneCards[card]; ok {
 			delete(oldZoneCards, card)
@@ -82,6 +356,55 @@ func (gs *GameState) moveCard(card *Card, newZone string) {
 	//prettyPrint(gs)
 }
 
+// Zones where the order of the cards matters.
+func isPositionalZone(zone string) bool {
+	switch zone {
+	case "FRIENDLY PLAY", "OPPOSING PLAY", "FRIENDLY HAND", "OPPOSING HAND":
+		return true
+	}
+	return false
+}
+
+// The cards in a zone, left to right. Cards without a known position go last.
+func (gs *GameState) getOrderedZone(zone string) []*Card {
+	result := make([]*Card, 0, len(gs.CardsByZone[zone]))
+	for card := range gs.CardsByZone[zone] {
+		result = append(result, card)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if (a.ZonePosition == 0) != (b.ZonePosition == 0) {
+			return b.ZonePosition == 0
+		}
+		if a.ZonePosition != b.ZonePosition {
+			return a.ZonePosition < b.ZonePosition
+		}
+		return a.InstanceId < b.InstanceId
+	})
+	return result
+}
+
+// The minions directly to the left and right of the given one, if any.
+func (gs *GameState) getAdjacentMinions(minion *Card) []*Card {
+	result := make([]*Card, 0, 2)
+	if minion.Zone != "FRIENDLY PLAY" && minion.Zone != "OPPOSING PLAY" {
+		return result
+	}
+	ordered := gs.getOrderedZone(minion.Zone)
+	for i, card := range ordered {
+		if card == minion {
+			if i > 0 {
+				result = append(result, ordered[i-1])
+			}
+			if i+1 < len(ordered) {
+				result = append(result, ordered[i+1])
+			}
+			break
+		}
+	}
+	return result
+}
+
 // -------------------
 // "hypothetical" operations on GameState that modify it.
 // These can be used as the function `applyMove` in `Move`.
@@ -93,45 +416,30 @@ func useCard(gs *GameState, params *MoveParams) {
 	switch playCard.Zone {
 	// If played from hand
 	case "FRIENDLY HAND":
-		gs.ManaTemp -= playCard.Cost
-		if gs.ManaTemp < 0 {
-			gs.ManaUsed -= gs.ManaTemp
-			gs.ManaTemp = 0
-		}
+		gs.payMana(playCard.Cost)
 		switch playCard.Type {
 		case "Minion":
-			// Warsong Commander
-			maybeTriggerWarsongCommander(gs, playCard)
 			// minion comes into play
-			gs.moveCard(playCard, "FRIENDLY PLAY")
+			gs.moveCardToPosition(playCard, "FRIENDLY PLAY", params.Position)
+			gs.fireTrigger(&TriggerContext{Event: EVENT_MINION_SUMMONED, Subject: playCard})
 			playCard.Exhausted = !playCard.Charge
 			// battlecry effects, if any
 			runCardPlayedAction(gs, params)
 		case "Spell":
+			gs.fireTrigger(&TriggerContext{Event: EVENT_SPELL_CAST, Subject: playCard})
 			// execute spell
 			runCardPlayedAction(gs, params)
 			gs.moveCard(playCard, "FRIENDLY GRAVEYARD")
-		case "FRIENDLY PLAY (Hero Power)":
-			// if using hero power
-			runCardPlayedAction(gs, params)
-			// hero power is now exhausted
-			playCard.Exhausted = true
 		case "Weapon":
-			// remove anything currently in weapon zone
-			friendlyHero := getSingletonFromZone(gs, "FRIENDLY PLAY (Hero)", true)
-			//prettyPrint(friendlyHero)
-			if oldWeapon := getSingletonFromZone(gs, "FRIENDLY PLAY (Weapon)", false); oldWeapon != nil {
-				// Yes, really destroy the weapon now: http://hearthstone.gamepedia.com/Advanced_rulebook#Instant_weapon_destruction
-				gs.handleDeath(oldWeapon)
-				friendlyHero.Attack -= oldWeapon.Attack
-			}
-			// new weapon to weapon zone
-			gs.moveCard(playCard, "FRIENDLY PLAY (Weapon)")
-			friendlyHero.Attack += playCard.Attack
-			// Assert we now have exactly one weapon.
-			getSingletonFromZone(gs, "FRIENDLY PLAY (Weapon)", true)
+			gs.equipWeapon(playCard)
 			// TODO (dz): other card types (Enchantment?)
 		}
+	// if using hero power
+	case "FRIENDLY PLAY (Hero Power)":
+		gs.payMana(playCard.Cost)
+		runCardPlayedAction(gs, params)
+		// hero power is now exhausted
+		playCard.Exhausted = true
 	// If on battlefield, then this is a minion attack.
 	case "FRIENDLY PLAY":
 		// TODO (dz): is it easier for nextMoves to call use or attack?
@@ -148,15 +456,40 @@ func useCard(gs *GameState, params *MoveParams) {
 	gs.cleanupState()
 }
 
-func maybeTriggerWarsongCommander(gs *GameState, card *Card) {
-	if card.Attack <= 3 {
-		for friendlyMinion := range gs.CardsByZone["FRIENDLY PLAY"] {
-			if friendlyMinion.JsonCardId == "EX1_084" && !friendlyMinion.Silenced {
-				//fmt.Println("DEBUG: Getting charge from Warsong Commander.")
-				card.Charge = true
-			}
-		}
+// Spends mana, using up temporary mana (e.g. from The Coin) first.
+func (gs *GameState) payMana(cost int32) {
+	gs.ManaTemp -= cost
+	if gs.ManaTemp < 0 {
+		gs.ManaUsed -= gs.ManaTemp
+		gs.ManaTemp = 0
+	}
+}
+
+// Puts a weapon in our hero's hands, played or otherwise.
+func (gs *GameState) equipWeapon(weapon *Card) {
+	// remove anything currently in weapon zone
+	friendlyHero := getSingletonFromZone(gs, "FRIENDLY PLAY (Hero)", true)
+	//prettyPrint(friendlyHero)
+	if oldWeapon := getSingletonFromZone(gs, "FRIENDLY PLAY (Weapon)", false); oldWeapon != nil {
+		// Yes, really destroy the weapon now: http://hearthstone.gamepedia.com/Advanced_rulebook#Instant_weapon_destruction
+		gs.handleDeath(oldWeapon)
+	}
+	// new weapon to weapon zone
+	gs.moveCard(weapon, "FRIENDLY PLAY (Weapon)")
+	friendlyHero.Attack += weapon.Attack
+	if weapon.Windfury {
+		friendlyHero.Windfury = true
+	}
+	// Assert we now have exactly one weapon.
+	getSingletonFromZone(gs, "FRIENDLY PLAY (Weapon)", true)
+}
+
+// Heals a character by up to `amount`, but not past its Health.
+func (gs *GameState) restoreHealth(target *Card, amount int32) {
+	if amount > target.Damage {
+		amount = target.Damage
 	}
+	target.Damage -= amount
 }
 
 // Run the action out of GlobalCardPlayedActions for a given move.
@@ -176,23 +509,55 @@ func runDeathrattleAction(gs *GameState, dyingMinion *Card) {
 }
 
 func (gs *GameState) CreateNewMinion(jsonId string, zone string) *Card {
+	return gs.createNewMinionAtPosition(jsonId, zone, 0)
+}
+
+// Summons up to `n` copies of a minion on the right of `zone`, as space
+// allows.
+func (gs *GameState) summonMinions(jsonId string, zone string, n int) {
+	for i := 0; i < n && len(gs.CardsByZone[zone]) < 7; i++ {
+		gs.CreateNewMinion(jsonId, zone)
+	}
+}
+
+// Like CreateNewMinion, but at the given 1-based position (0 for the right end).
+func (gs *GameState) createNewMinionAtPosition(jsonId string, zone string, position int32) *Card {
 	card := gs.getOrCreateCard(jsonId, gs.HighestCardId+1)
 	card.Exhausted = true
-	maybeTriggerWarsongCommander(gs, card)
-	gs.moveCard(card, zone)
+	gs.moveCardToPosition(card, zone, position)
+	gs.fireTrigger(&TriggerContext{Event: EVENT_MINION_SUMMONED, Subject: card})
 	return card
 }
 
 // Minion attack or weapon attack (modifies `gs` and the cards in it).
 func attack(gs *GameState, params *MoveParams) {
-	gs.dealDamage(params.CardOne, params.CardTwo.Attack)
-	gs.dealDamage(params.CardTwo, params.CardOne.Attack)
-	params.CardOne.NumAttacksThisTurn += 1
+	gs.fireTrigger(&TriggerContext{Event: EVENT_ATTACK_DECLARED, Subject: params.CardOne, Target: params.CardTwo})
+	attacker, defender := params.CardOne, params.CardTwo
+	// Attacking gives away where you are.
+	attacker.Stealth = false
+	if gs.dealDamage(attacker, defender.Attack) > 0 && defender.isPoisonous() && attacker.Type == "Minion" {
+		attacker.PendingDestroy = true
+	}
+	if gs.dealDamage(defender, attacker.Attack) > 0 && attacker.isPoisonous() && defender.Type == "Minion" {
+		defender.PendingDestroy = true
+	}
+	attacker.NumAttacksThisTurn += 1
+	if attacker.Type == "Hero" {
+		// Swinging a weapon costs it a durability, even when it hits nothing.
+		if weapon := getSingletonFromZone(gs, getSide(attacker.Zone)+" PLAY (Weapon)", false); weapon != nil {
+			weapon.Damage += 1
+		}
+	}
 }
 
-func (gs *GameState) dealDamage(target *Card, amount int32) {
-	if amount <= 0 {
-		return
+// Returns how much damage actually got through Immune and Divine Shield.
+func (gs *GameState) dealDamage(target *Card, amount int32) int32 {
+	if amount <= 0 || target.Immune {
+		return 0
+	}
+	if target.hasDivineShield() {
+		target.DivineShield = false
+		return 0
 	}
 
 	target.JustTookDamage = true
@@ -202,30 +567,20 @@ func (gs *GameState) dealDamage(target *Card, amount int32) {
 		target.Armor = 0
 	}
 
-	if target.Type == "Minion" {
-		for friendlyMinion := range gs.CardsByZone["FRIENDLY PLAY"] {
-			if friendlyMinion.JsonCardId == "EX1_604" && !friendlyMinion.Silenced { // Frothing Berserker
-				friendlyMinion.Attack += 1
-				//fmt.Printf("DEBUG: My blade be thirsty! Attack is now %v\n", friendlyMinion.Attack)
-			}
-		}
-		for enemyMinion := range gs.CardsByZone["OPPOSING PLAY"] {
-			if enemyMinion.JsonCardId == "EX1_604" && !enemyMinion.Silenced { // Frothing Berserker
-				//fmt.Println("DEBUG: Enemy Frothing Berserker triggered.")
-				enemyMinion.Attack += 1
-			}
-		}
-	}
+	gs.fireTrigger(&TriggerContext{Event: EVENT_DAMAGE_TAKEN, Subject: target, Amount: amount})
+	return amount
 }
 
 func minionNeedsKilling(card *Card) bool {
 	return card.PendingDestroy || card.Damage >= card.Health
 }
 
-// Clean up the gs state, moving cards to their zones, executing deathrattles, etc
+// Clean up the gs state, moving cards to their zones, executing deathrattles, etc.
+// Follows the Advanced Rulebook: first the aftermath of whatever just
+// happened (e.g. Grim Patron summoning, while the dying still take up board
+// space), then a death phase, repeated until nothing more happens.
+// http://hearthstone.gamepedia.com/Advanced_rulebook#Death_Creation_Step
 func (gs *GameState) cleanupState() {
-	// check for PendingDestroy or lethal damage on minions
-	didAnything := false
 	friendlyHero := getSingletonFromZone(gs, "FRIENDLY PLAY (Hero)", true)
 	enemyHero := getSingletonFromZone(gs, "OPPOSING PLAY (Hero)", true)
 	if minionNeedsKilling(friendlyHero) {
@@ -239,118 +594,237 @@ func (gs *GameState) cleanupState() {
 	friendlyHero.JustTookDamage = false
 	enemyHero.JustTookDamage = false
 
-	for minion, _ := range gs.CardsByZone["FRIENDLY PLAY"] {
-		if minionNeedsKilling(minion) {
-			didAnything = true
-			//fmt.Println("Minion should die due to damage: ", minion)
-			gs.handleDeath(minion)
-		} else if minion.JustTookDamage && minion.JsonCardId == "BRM_019" &&
-			!minion.Silenced && len(gs.CardsByZone["FRIENDLY PLAY"]) < 7 {
-			// We're not bad people, but we did a bad thing...
-			// TODO: Implement some kind of generic listener framework someday.
-			//fmt.Println("DEBUG: Everyone! Get in here!")
-			didAnything = true
-			gs.CreateNewMinion("BRM_019", "FRIENDLY PLAY")
+	didAnything := gs.resolveSurvivedDamage()
+	if gs.runDeathPhase() {
+		didAnything = true
+	}
+	if didAnything {
+		gs.cleanupState()
+	} else {
+		gs.updateAdjacencyAuras()
+	}
+}
+
+// Minions that took damage and aren't about to die get to react to it, in
+// play order. Returns whether any triggers ran.
+func (gs *GameState) resolveSurvivedDamage() bool {
+	var survivors []*Card
+	for _, zone := range []string{"FRIENDLY PLAY", "OPPOSING PLAY"} {
+		for minion := range gs.CardsByZone[zone] {
+			if minion.JustTookDamage && !minionNeedsKilling(minion) {
+				survivors = append(survivors, minion)
+			}
 		}
-		minion.JustTookDamage = false
 	}
-	for minion, _ := range gs.CardsByZone["OPPOSING PLAY"] {
-		if minionNeedsKilling(minion) {
+	sortByPlayOrder(survivors)
+	didAnything := false
+	for _, minion := range survivors {
+		minion.JustTookDamage = false
+		if gs.fireTrigger(&TriggerContext{Event: EVENT_SURVIVED_DAMAGE, Subject: minion}) {
 			didAnything = true
-			//fmt.Println("Minion should die due to damage: ", minion)
-			gs.handleDeath(minion)
 		}
-		minion.JustTookDamage = false
 	}
-	if didAnything {
-		gs.cleanupState()
+	return didAnything
+}
+
+// Every mortally wounded or destroyed minion leaves play at once, then their
+// deathrattles resolve in the order they were played. Returns whether
+// anything died.
+func (gs *GameState) runDeathPhase() bool {
+	var dying []*Card
+	for _, zone := range []string{"FRIENDLY PLAY", "OPPOSING PLAY"} {
+		for minion := range gs.CardsByZone[zone] {
+			if minionNeedsKilling(minion) {
+				//fmt.Println("Minion should die due to damage: ", minion)
+				dying = append(dying, minion)
+			}
+		}
+	}
+	for _, zone := range []string{"FRIENDLY PLAY (Weapon)", "OPPOSING PLAY (Weapon)"} {
+		for weapon := range gs.CardsByZone[zone] {
+			if weaponNeedsDestroying(weapon) {
+				dying = append(dying, weapon)
+			}
+		}
+	}
+	sortByPlayOrder(dying)
+	for _, card := range dying {
+		gs.removeFromPlay(card)
+	}
+	for _, card := range dying {
+		gs.afterDeath(card)
+	}
+	return len(dying) > 0
+}
+
+// Kills a single card right away, outside of a death phase, e.g. a weapon
+// being replaced.
+func (gs *GameState) handleDeath(card *Card) {
+	gs.removeFromPlay(card)
+	gs.afterDeath(card)
+}
+
+// Moves a dead card to the graveyard, taking a weapon's Attack away from
+// its hero.
+func (gs *GameState) removeFromPlay(card *Card) {
+	if card.Type == "Weapon" {
+		hero := getSingletonFromZone(gs, getSide(card.Zone)+" PLAY (Hero)", false)
+		if hero != nil && isTriggerZone(card.Zone) {
+			hero.Attack -= card.Attack
+			if card.Windfury {
+				hero.Windfury = false
+			}
+		}
+	}
+	gs.moveCard(card, getGraveyard(card))
+	card.JustTookDamage = false
+}
+
+// Deathrattles and death triggers for a card that has left play.
+func (gs *GameState) afterDeath(card *Card) {
+	runDeathrattleAction(gs, card)
+	if card.Type == "Minion" {
+		gs.fireTrigger(&TriggerContext{Event: EVENT_MINION_DIED, Subject: card})
 	}
 }
 
-func (gs *GameState) handleDeath(minion *Card) {
-	// Execute deathrattle
-	runDeathrattleAction(gs, minion)
-	// Move to graveyard
-	gs.moveCard(minion, "FRIENDLY GRAVEYARD")
+// Weapons use DAMAGE for the durability they have lost.
+func weaponNeedsDestroying(weapon *Card) bool {
+	return weapon.PendingDestroy || (weapon.Durability > 0 && weapon.Damage >= weapon.Durability)
+}
+
+// The graveyard on the card's side of the board.
+func getGraveyard(card *Card) string {
+	if getSide(card.Zone) == "OPPOSING" {
+		return "OPPOSING GRAVEYARD"
+	}
+	return "FRIENDLY GRAVEYARD"
 }
 
 // A particular instance of a card in the game.
 type Card struct {
-	InstanceId         int32  // Globally unique.
-	JsonCardId         string // Refers to JsonCardData.Id
-	Type               string // Refers to JsonCardData.Type
-	Name               string // Refers to JsonCardData.Name
-	Cost               int32
-	Attack             int32
-	Health             int32
-	Armor              int32
-	Damage             int32
-	NumAttacksThisTurn int32
-	Charge             bool
-	Exhausted          bool
-	Frozen             bool
-	Taunt              bool
-	Silenced           bool
-	Zone               string
-	PendingDestroy     bool // Internal. Should this minion be destroyed in the next cleanup step?
-	JustTookDamage     bool // Internal. Did this minion take damage since the last cleanup step?
+	InstanceId                 int32  `json:"instanceId"` // Globally unique.
+	JsonCardId                 string `json:"jsonCardId"` // Refers to JsonCardData.Id
+	Type                       string `json:"type"`       // Refers to JsonCardData.Type
+	Name                       string `json:"name"`       // Refers to JsonCardData.Name
+	Cost                       int32  `json:"cost"`
+	Attack                     int32  `json:"attack"`
+	Health                     int32  `json:"health"`
+	Durability                 int32  `json:"durability"` // Weapons only. Damage counts the durability lost.
+	Armor                      int32  `json:"armor"`
+	Damage                     int32  `json:"damage"`
+	NumAttacksThisTurn         int32  `json:"numAttacksThisTurn"`
+	Charge                     bool   `json:"charge"`
+	Exhausted                  bool   `json:"exhausted"`
+	Frozen                     bool   `json:"frozen"`
+	Taunt                      bool   `json:"taunt"`
+	DivineShield               bool   `json:"divineShield"`
+	Windfury                   bool   `json:"windfury"`
+	Stealth                    bool   `json:"stealth"`
+	Poisonous                  bool   `json:"poisonous"`
+	Immune                     bool   `json:"immune"`
+	SpellPower                 int32  `json:"spellPower"` // Extra damage for its side's spells while in play.
+	CantBeTargetedBySpells     bool   `json:"cantBeTargetedBySpells"`
+	CantBeTargetedByHeroPowers bool   `json:"cantBeTargetedByHeroPowers"`
+	Silenced                   bool   `json:"silenced"`
+	Zone                       string `json:"zone"`
+	Controller                 int32  `json:"controller"`     // PlayerId of the owner, from the log. 0 for hypothetical cards.
+	ZoneTag                    string `json:"zoneTag"`        // Raw ZONE tag from the log, e.g. "PLAY".
+	ZonePosition               int32  `json:"zonePosition"`   // 1-based, left to right, in positional zones. 0 elsewhere or if unknown.
+	AuraAttack                 int32  `json:"auraAttack"`     // How much of Attack comes from adjacency auras.
+	PlayOrder                  int32  `json:"playOrder"`      // When the card last entered play, for ordering triggers. 0 if never.
+	CreatorId                  int32  `json:"creatorId"`      // InstanceId of the card that created this one, from the log. 0 if it came from a deck.
+	TakenFromDeck              string `json:"takenFromDeck"`  // The JsonCardId this card took out of RemainingDeck when it left our deck, if any.
+	PendingDestroy             bool   `json:"pendingDestroy"` // Internal. Should this minion be destroyed in the next cleanup step?
+	JustTookDamage             bool   `json:"-"`              // Internal. Did this minion take damage since the last cleanup step?
 }
 
+// Keywords stop counting once a minion is silenced. Silences from the log
+// clear the tags themselves, but hypothetical ones only set Silenced.
+func (c *Card) hasDivineShield() bool { return c.DivineShield && !c.Silenced }
+func (c *Card) hasWindfury() bool     { return c.Windfury && !c.Silenced }
+func (c *Card) hasStealth() bool      { return c.Stealth && !c.Silenced }
+func (c *Card) isPoisonous() bool     { return c.Poisonous && !c.Silenced }
+
 // TODO (dz): this is kinda hacky... Card should really be a struct with just InstanceId + CardInfo,
 // but I'm too lazy to change it for now.
 // An internal class representing the aspects of a Card that matter to the game
 // (everything besides the InstanceId)
 type CardInfo struct {
-	JsonCardId         string // Refers to JsonCardData.Id
-	Type               string // Refers to JsonCardData.Type
-	Name               string // Refers to JsonCardData.Name
-	Cost               int32
-	Attack             int32
-	Health             int32
-	Armor              int32
-	Damage             int32
-	NumAttacksThisTurn int32
-	Charge             bool
-	Exhausted          bool
-	Frozen             bool
-	Taunt              bool
-	Silenced           bool
-	Zone               string
-	PendingDestroy     bool // Internal. Should this minion be destroyed in the next cleanup step?
+	JsonCardId                 string // Refers to JsonCardData.Id
+	Type                       string // Refers to JsonCardData.Type
+	Name                       string // Refers to JsonCardData.Name
+	Cost                       int32
+	Attack                     int32
+	Health                     int32
+	Durability                 int32
+	Armor                      int32
+	Damage                     int32
+	NumAttacksThisTurn         int32
+	Charge                     bool
+	Exhausted                  bool
+	Frozen                     bool
+	Taunt                      bool
+	DivineShield               bool
+	Windfury                   bool
+	Stealth                    bool
+	Poisonous                  bool
+	Immune                     bool
+	SpellPower                 int32
+	CantBeTargetedBySpells     bool
+	CantBeTargetedByHeroPowers bool
+	Silenced                   bool
+	Zone                       string
+	PendingDestroy             bool // Internal. Should this minion be destroyed in the next cleanup step?
 }
 
 func (c *Card) getInfo() CardInfo {
 	return CardInfo{
-		JsonCardId:         c.JsonCardId,
-		Type:               c.Type,
-		Name:               c.Name,
-		Cost:               c.Cost,
-		Attack:             c.Attack,
-		Health:             c.Health,
-		Armor:              c.Armor,
-		Damage:             c.Damage,
-		NumAttacksThisTurn: c.NumAttacksThisTurn,
-		Charge:             c.Charge,
-		Exhausted:          c.Exhausted,
-		Frozen:             c.Frozen,
-		Taunt:              c.Taunt,
-		Silenced:           c.Silenced,
-		Zone:               c.Zone,
-		PendingDestroy:     c.PendingDestroy,
+		JsonCardId:                 c.JsonCardId,
+		Type:                       c.Type,
+		Name:                       c.Name,
+		Cost:                       c.Cost,
+		Attack:                     c.Attack,
+		Health:                     c.Health,
+		Durability:                 c.Durability,
+		Armor:                      c.Armor,
+		Damage:                     c.Damage,
+		NumAttacksThisTurn:         c.NumAttacksThisTurn,
+		Charge:                     c.Charge,
+		Exhausted:                  c.Exhausted,
+		Frozen:                     c.Frozen,
+		Taunt:                      c.Taunt,
+		DivineShield:               c.DivineShield,
+		Windfury:                   c.Windfury,
+		Stealth:                    c.Stealth,
+		Poisonous:                  c.Poisonous,
+		Immune:                     c.Immune,
+		SpellPower:                 c.SpellPower,
+		CantBeTargetedBySpells:     c.CantBeTargetedBySpells,
+		CantBeTargetedByHeroPowers: c.CantBeTargetedByHeroPowers,
+		Silenced:                   c.Silenced,
+		Zone:                       c.Zone,
+		PendingDestroy:             c.PendingDestroy,
 	}
 }
 
 // for enemy minions, we don't care about JsonCardId.
 func (c *Card) getInfoAsEnemyMinion() CardInfo {
 	return CardInfo{
-		Type:           c.Type,
-		Name:           c.Name,
-		Attack:         c.Attack,
-		Health:         c.Health,
-		Armor:          c.Armor,
-		Damage:         c.Damage,
-		Taunt:          c.Taunt,
-		Zone:           c.Zone,
-		PendingDestroy: c.PendingDestroy,
+		Type:                       c.Type,
+		Name:                       c.Name,
+		Attack:                     c.Attack,
+		Health:                     c.Health,
+		Armor:                      c.Armor,
+		Damage:                     c.Damage,
+		Taunt:                      c.Taunt,
+		DivineShield:               c.hasDivineShield(),
+		Stealth:                    c.hasStealth(),
+		Poisonous:                  c.isPoisonous(),
+		Immune:                     c.Immune,
+		CantBeTargetedBySpells:     c.CantBeTargetedBySpells && !c.Silenced,
+		CantBeTargetedByHeroPowers: c.CantBeTargetedByHeroPowers && !c.Silenced,
+		Zone:                       c.Zone,
+		PendingDestroy:             c.PendingDestroy,
 	}
 }
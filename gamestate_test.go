@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -139,3 +141,389 @@ func TestDedup(t *testing.T) {
 	}
 
 }
+
+func TestSaveLoad(t *testing.T) {
+	gs := createEmptyGameState()
+	gs.ManaMax = 7
+	gs.Turn = 9
+	gs.LocalPlayerId = 1
+	gs.Players[1] = &Player{PlayerId: 1, Name: "DrTall"}
+	berserker := gs.CreateNewMinion("EX1_604", "FRIENDLY PLAY")
+	berserker.Damage = 1
+	berserker.Attack = 5
+
+	var buf bytes.Buffer
+	if err := gs.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(buf.String())
+	loaded, err := LoadGameState(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ManaMax != 7 || loaded.Turn != 9 || loaded.LocalPlayerId != 1 || loaded.Players[1].Name != "DrTall" {
+		t.Error("GameState fields not restored.")
+	}
+	loadedBerserker := loaded.CardsById[berserker.InstanceId]
+	if loadedBerserker == nil || *loadedBerserker != *berserker {
+		t.Error("Card not restored:", loadedBerserker)
+	}
+	if _, ok := loaded.CardsByZone["FRIENDLY PLAY"][loadedBerserker]; !ok {
+		t.Error("CardsByZone not rebuilt.")
+	}
+	if getSingletonFromZone(loaded, "OPPOSING PLAY (Hero)", true) == nil {
+		t.Error("Hero not restored.")
+	}
+
+	if _, err := LoadGameState(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Error("Loaded a snapshot from the future.")
+	}
+	if _, err := LoadGameState(strings.NewReader(`{"version": 1, "cards": [null]}`)); err == nil {
+		t.Error("Loaded a snapshot with a null card.")
+	}
+	if _, err := LoadGameState(strings.NewReader(`{"version": 1, "players": [null]}`)); err == nil {
+		t.Error("Loaded a snapshot with a null player.")
+	}
+	if _, err := LoadGameState(strings.NewReader(`{"version": 1, "players": [{"playerId": 1}, {"playerId": 1}]}`)); err == nil {
+		t.Error("Loaded a snapshot with a duplicate player.")
+	}
+}
+
+func TestLoadWithoutHighestIds(t *testing.T) {
+	// A hand-written puzzle that leaves out highestCardId and highestPlayOrder.
+	loaded, err := LoadGameState(strings.NewReader(`{"version": 1, "cards": [
+		{"instanceId": 1, "jsonCardId": "HERO_01", "type": "Hero", "zone": "FRIENDLY PLAY (Hero)"},
+		{"instanceId": 5, "jsonCardId": "EX1_604", "type": "Minion", "zone": "FRIENDLY PLAY", "playOrder": 3}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.HighestCardId != 5 || loaded.HighestPlayOrder != 3 {
+		t.Error("Expected the highest ids from the cards:", loaded.HighestCardId, loaded.HighestPlayOrder)
+	}
+	minion := loaded.CreateNewMinion("EX1_604", "FRIENDLY PLAY")
+	if minion.InstanceId != 6 || minion.PlayOrder != 4 {
+		t.Error("Expected new ids past the loaded ones:", minion.InstanceId, minion.PlayOrder)
+	}
+	if getSingletonFromZone(loaded, "FRIENDLY PLAY (Hero)", false) == nil {
+		t.Error("Hero moved out of its zone.")
+	}
+}
+
+func TestZonePositions(t *testing.T) {
+	gs := createEmptyGameState()
+	a := gs.CreateNewMinion("EX1_604", "FRIENDLY PLAY")
+	b := gs.CreateNewMinion("EX1_604", "FRIENDLY PLAY")
+	c := gs.createNewMinionAtPosition("EX1_604", "FRIENDLY PLAY", 1)
+	if c.ZonePosition != 1 || a.ZonePosition != 2 || b.ZonePosition != 3 {
+		t.Error("Insert did not shift:", c.ZonePosition, a.ZonePosition, b.ZonePosition)
+	}
+	gs.moveCard(a, "FRIENDLY GRAVEYARD")
+	if a.ZonePosition != 0 || c.ZonePosition != 1 || b.ZonePosition != 2 {
+		t.Error("Removal did not close the gap:", a.ZonePosition, c.ZonePosition, b.ZonePosition)
+	}
+	if ordered := gs.getOrderedZone("FRIENDLY PLAY"); len(ordered) != 2 || ordered[0] != c || ordered[1] != b {
+		t.Error("Wrong order:", ordered)
+	}
+	if adjacent := gs.getAdjacentMinions(c); len(adjacent) != 1 || adjacent[0] != b {
+		t.Error("Wrong neighbours:", adjacent)
+	}
+	gs2 := gs.DeepCopy()
+	if gs2.CardsById[c.InstanceId].ZonePosition != 1 || gs2.CardsById[b.InstanceId].ZonePosition != 2 {
+		t.Error("DeepCopy changed positions.")
+	}
+}
+
+func TestAdjacency(t *testing.T) {
+	gs := createEmptyGameState()
+	gs.ManaMax = 10
+	left := gs.CreateNewMinion("EX1_604", "FRIENDLY PLAY")  // Frothing Berserker
+	right := gs.CreateNewMinion("EX1_506", "FRIENDLY PLAY") // Murloc Tidehunter
+	totem := gs.CreateNewMinion("EX1_565", "FRIENDLY HAND") // Flametongue Totem
+	argus := gs.CreateNewMinion("EX1_093", "FRIENDLY HAND") // Defender of Argus
+	useCard(&gs, &MoveParams{CardOne: totem, Position: 2})
+	if left.Attack != 4 || right.Attack != 4 {
+		t.Error("Flametongue aura not applied:", left.Attack, right.Attack)
+	}
+	useCard(&gs, &MoveParams{CardOne: argus, Position: 1})
+	if !left.Taunt || left.Attack != 5 || left.Health != 5 || right.Taunt {
+		t.Error("Defender of Argus hit the wrong minions:", left, right)
+	}
+	gs.moveCard(totem, "FRIENDLY GRAVEYARD")
+	gs.cleanupState()
+	if left.Attack != 3 || right.Attack != 2 {
+		t.Error("Flametongue aura not removed:", left.Attack, right.Attack)
+	}
+}
+
+func TestTriggers(t *testing.T) {
+	gs := createEmptyGameState()
+	gs.ManaMax = 10
+	berserker := gs.CreateNewMinion("EX1_604", "FRIENDLY PLAY") // Frothing Berserker
+	gs.CreateNewMinion("EX1_402", "FRIENDLY PLAY")              // Armorsmith
+	patron := gs.CreateNewMinion("BRM_019", "FRIENDLY PLAY")    // Grim Patron
+	gs.CreateNewMinion("EX1_084", "FRIENDLY PLAY")              // Warsong Commander
+	enemyBerserker := gs.CreateNewMinion("EX1_604", "OPPOSING PLAY")
+	enemyArmorsmith := gs.CreateNewMinion("EX1_402", "OPPOSING PLAY")
+	enemyArmorsmith.Silenced = true
+	whirlwind := gs.CreateNewMinion("EX1_400", "FRIENDLY HAND")
+	useCard(&gs, &MoveParams{CardOne: whirlwind})
+
+	if berserker.Attack != 8 || enemyBerserker.Attack != 8 {
+		t.Error("Frothing Berserkers should see all 6 minions damaged:", berserker.Attack, enemyBerserker.Attack)
+	}
+	if hero := getSingletonFromZone(&gs, "FRIENDLY PLAY (Hero)", true); hero.Armor != 4 {
+		t.Error("Armorsmith should give 1 armor per friendly minion damaged, got", hero.Armor)
+	}
+	if hero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true); hero.Armor != 0 {
+		t.Error("Silenced Armorsmith gave armor:", hero.Armor)
+	}
+	if len(gs.CardsByZone["FRIENDLY PLAY"]) != 5 {
+		t.Fatal("Grim Patron should have summoned one friend, board is", len(gs.CardsByZone["FRIENDLY PLAY"]))
+	}
+	ordered := gs.getOrderedZone("FRIENDLY PLAY")
+	newPatron := ordered[patron.ZonePosition]
+	if newPatron.JsonCardId != "BRM_019" || newPatron == patron {
+		t.Error("New Grim Patron should be just right of the old one:", newPatron)
+	}
+	if !newPatron.Charge {
+		t.Error("Warsong Commander should give the new Grim Patron charge")
+	}
+}
+
+func TestTriggerPlayOrder(t *testing.T) {
+	gs := createEmptyGameState()
+	first := gs.CreateNewMinion("EX1_604", "FRIENDLY PLAY")
+	second := gs.CreateNewMinion("EX1_604", "FRIENDLY PLAY")
+	var fired []*Card
+	GlobalTriggerHandlers["TEST_ORDER"] = map[int]TriggerHandler{
+		EVENT_DAMAGE_TAKEN: func(gs *GameState, owner *Card, ctx *TriggerContext) { fired = append(fired, owner) },
+	}
+	defer delete(GlobalTriggerHandlers, "TEST_ORDER")
+	first.JsonCardId = "TEST_ORDER"
+	second.JsonCardId = "TEST_ORDER"
+	// Replaying the first one makes it the newest.
+	gs.moveCard(first, "FRIENDLY HAND")
+	gs.moveCard(first, "FRIENDLY PLAY")
+	gs.dealDamage(first, 1)
+	if len(fired) != 2 || fired[0] != second || fired[1] != first {
+		t.Error("Triggers should fire in play order:", fired)
+	}
+}
+
+func TestDeathPhase(t *testing.T) {
+	gs := createEmptyGameState()
+	first := gs.CreateNewMinion("CS2_231", "OPPOSING PLAY")  // Wisp
+	second := gs.CreateNewMinion("CS2_231", "FRIENDLY PLAY") // Wisp
+	third := gs.CreateNewMinion("CS2_231", "OPPOSING PLAY")  // Wisp
+	var died []*Card
+	GlobalDeathrattleActions["TEST_DEATH"] = func(gs *GameState, params *MoveParams) {
+		if params.CardOne.Zone != getGraveyard(params.CardOne) {
+			t.Error("Deathrattle ran before its minion left play:", params.CardOne.Zone)
+		}
+		died = append(died, params.CardOne)
+	}
+	defer delete(GlobalDeathrattleActions, "TEST_DEATH")
+	for _, minion := range []*Card{first, second, third} {
+		minion.JsonCardId = "TEST_DEATH"
+		minion.PendingDestroy = true
+	}
+	gs.cleanupState()
+	if len(died) != 3 || died[0] != first || died[1] != second || died[2] != third {
+		t.Error("Deathrattles should resolve in play order:", died)
+	}
+	if first.Zone != "OPPOSING GRAVEYARD" || second.Zone != "FRIENDLY GRAVEYARD" {
+		t.Error("Minions should go to their own side's graveyard:", first.Zone, second.Zone)
+	}
+}
+
+func TestPatronBoardSpace(t *testing.T) {
+	gs := createEmptyGameState()
+	patron := gs.CreateNewMinion("BRM_019", "FRIENDLY PLAY") // Grim Patron
+	for i := 0; i < 6; i++ {
+		gs.CreateNewMinion("CS2_231", "FRIENDLY PLAY") // Wisp
+	}
+	// The Wisps are still on the board when the Patron tries to summon.
+	whirlwindAction(&gs, nil)
+	gs.cleanupState()
+	if len(gs.CardsByZone["FRIENDLY PLAY"]) != 1 || patron.Zone != "FRIENDLY PLAY" {
+		t.Error("Grim Patron should not summon onto a full board:", len(gs.CardsByZone["FRIENDLY PLAY"]))
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	gs := createEmptyGameState()
+	squire := gs.CreateNewMinion("EX1_008", "OPPOSING PLAY") // Argent Squire
+	cobra := gs.CreateNewMinion("EX1_170", "FRIENDLY PLAY")  // Emperor Cobra
+	infiltrator := gs.CreateNewMinion("EX1_010", "FRIENDLY PLAY")
+	if !squire.DivineShield || !cobra.Poisonous || !infiltrator.Stealth {
+		t.Fatal("Keywords not read from the card json:", squire, cobra, infiltrator)
+	}
+
+	attack(&gs, &MoveParams{CardOne: cobra, CardTwo: squire})
+	gs.cleanupState()
+	if squire.DivineShield || squire.Damage != 0 || squire.Zone != "OPPOSING PLAY" {
+		t.Error("Divine Shield should soak the first hit, and poison with it:", squire)
+	}
+	attack(&gs, &MoveParams{CardOne: cobra, CardTwo: squire})
+	gs.cleanupState()
+	if squire.Zone != "OPPOSING GRAVEYARD" {
+		t.Error("Poisonous should kill:", squire)
+	}
+
+	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
+	enemyHero.Immune = true
+	attack(&gs, &MoveParams{CardOne: infiltrator, CardTwo: enemyHero})
+	if enemyHero.Damage != 0 {
+		t.Error("Immune hero took damage:", enemyHero.Damage)
+	}
+	if infiltrator.Stealth {
+		t.Error("Attacking should break Stealth")
+	}
+}
+
+func TestWeaponDurability(t *testing.T) {
+	gs := createEmptyGameState()
+	gs.ManaMax = 10
+	hero := getSingletonFromZone(&gs, "FRIENDLY PLAY (Hero)", true)
+	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
+	wisp := gs.CreateNewMinion("CS2_231", "OPPOSING PLAY") // Wisp
+	bite := gs.CreateNewMinion("FP1_021", "FRIENDLY HAND") // Death's Bite
+	useCard(&gs, &MoveParams{CardOne: bite})
+	if hero.Attack != 4 || bite.Durability != 2 {
+		t.Fatal("Death's Bite not equipped:", hero.Attack, bite.Durability)
+	}
+	for i := 0; i < 2; i++ {
+		hero.NumAttacksThisTurn = 0
+		useCard(&gs, &MoveParams{CardOne: hero, CardTwo: enemyHero})
+	}
+	if enemyHero.Damage != 8 {
+		t.Error("Expected two swings of 4, got", enemyHero.Damage)
+	}
+	if bite.Zone != "FRIENDLY GRAVEYARD" || hero.Attack != 0 {
+		t.Error("Death's Bite should break after two swings:", bite.Zone, hero.Attack)
+	}
+	if wisp.Zone != "OPPOSING GRAVEYARD" {
+		t.Error("Death's Bite's deathrattle should have killed the Wisp")
+	}
+}
+
+func TestSpellDamage(t *testing.T) {
+	gs := createEmptyGameState()
+	gs.ManaMax = 10
+	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
+	gs.CreateNewMinion("CS2_142", "FRIENDLY PLAY") // Kobold Geomancer
+	malygos := gs.CreateNewMinion("EX1_563", "FRIENDLY PLAY")
+	gs.CreateNewMinion("CS2_052", "OPPOSING PLAY") // Wrath of Air Totem, on the wrong side
+	if malygos.SpellPower != 5 {
+		t.Error("Malygos should have Spell Damage +5, got", malygos.SpellPower)
+	}
+	malygos.Silenced = true
+	fireball := gs.CreateNewMinion("CS2_029", "FRIENDLY HAND")
+	useCard(&gs, &MoveParams{CardOne: fireball, CardTwo: enemyHero})
+	if enemyHero.Damage != 7 {
+		t.Error("Fireball with one Spell Damage should deal 7, got", enemyHero.Damage)
+	}
+
+	dragon := gs.CreateNewMinion("NEW1_023", "OPPOSING PLAY") // Faerie Dragon
+	filter := getPlayCardTargetFilter(gs.CreateNewMinion("CS2_008", "FRIENDLY HAND"))
+	if filter(dragon) || !filter(enemyHero) {
+		t.Error("Faerie Dragon should not be a valid Moonfire target")
+	}
+	dragon.Silenced = true
+	if !filter(dragon) {
+		t.Error("A silenced Faerie Dragon can be targeted")
+	}
+}
+
+func TestHeroPowers(t *testing.T) {
+	useHeroPower := func(gs *GameState, jsonId string, target *Card) *Card {
+		heroPower := gs.getOrCreateCard(jsonId, gs.HighestCardId+1)
+		// AllSets.json doesn't have the upgraded hero powers.
+		heroPower.Type = "Hero Power"
+		heroPower.Cost = 2
+		gs.moveCard(heroPower, "FRIENDLY PLAY (Hero Power)")
+		gs.ManaMax = 10
+		useCard(gs, &MoveParams{CardOne: heroPower, CardTwo: target})
+		gs.moveCard(heroPower, "FRIENDLY GRAVEYARD")
+		return heroPower
+	}
+
+	gs := createEmptyGameState()
+	friendlyHero := getSingletonFromZone(&gs, "FRIENDLY PLAY (Hero)", true)
+	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
+	if !useHeroPower(&gs, "DS1h_292", nil).Exhausted || enemyHero.Damage != 2 {
+		t.Error("Steady Shot should deal 2 damage to the enemy hero, and exhaust itself")
+	}
+	useHeroPower(&gs, "CS1h_001", enemyHero)
+	if enemyHero.Damage != 0 {
+		t.Error("Lesser Heal should heal up to 2 damage, got", enemyHero.Damage)
+	}
+	useHeroPower(&gs, "CS2_017", nil)
+	if friendlyHero.Attack != 1 || friendlyHero.Armor != 1 {
+		t.Error("Shapeshift should give +1 Attack and +1 Armor:", friendlyHero.Attack, friendlyHero.Armor)
+	}
+	useHeroPower(&gs, "CS2_056", nil)
+	if friendlyHero.Damage != 1 || friendlyHero.Armor != 0 || gs.PendingDraws != 1 {
+		t.Error("Life Tap should deal 2 damage and draw a card:", friendlyHero.Damage, gs.PendingDraws)
+	}
+	useHeroPower(&gs, "AT_132_PALADIN", nil)
+	if len(gs.CardsByZone["FRIENDLY PLAY"]) != 2 {
+		t.Error("The Silver Hand should summon two Recruits")
+	}
+	useHeroPower(&gs, "AT_132_ROGUE", nil)
+	if friendlyHero.Attack != 3 || getSingletonFromZone(&gs, "FRIENDLY PLAY (Weapon)", true).Durability != 2 {
+		t.Error("Poisoned Daggers should equip a 2/2 weapon:", friendlyHero.Attack)
+	}
+	useHeroPower(&gs, "CS2_083b", nil)
+	if friendlyHero.Attack != 2 {
+		t.Error("Dagger Mastery should replace the old weapon with a 1/2:", friendlyHero.Attack)
+	}
+	if gs.ManaUsed != 14 {
+		t.Error("Each hero power should cost 2 mana, spent", gs.ManaUsed)
+	}
+}
+
+func TestOpponentPerspectiveTurnEvents(t *testing.T) {
+	gs := createEmptyGameState()
+	ours := gs.CreateNewMinion("CS2_231", "FRIENDLY PLAY")   // Wisp
+	theirs := gs.CreateNewMinion("CS2_231", "OPPOSING PLAY") // Wisp
+	ours.JsonCardId = "TEST_TURN"
+	theirs.JsonCardId = "TEST_TURN"
+	var events []string
+	GlobalTriggerHandlers["TEST_TURN"] = map[int]TriggerHandler{
+		EVENT_TURN_END: func(gs *GameState, owner *Card, ctx *TriggerContext) {
+			if areFriends(owner, ctx.Subject) {
+				events = append(events, "end "+owner.Zone)
+			}
+		},
+		EVENT_TURN_START: func(gs *GameState, owner *Card, ctx *TriggerContext) {
+			if areFriends(owner, ctx.Subject) {
+				events = append(events, "start "+owner.Zone)
+			}
+		},
+	}
+	defer delete(GlobalTriggerHandlers, "TEST_TURN")
+
+	gs.OpponentPerspective()
+	// Our Wisp sees our turn end, then (on the other side of the flip)
+	// their Wisp sees their turn start.
+	if len(events) != 2 || events[0] != "end FRIENDLY PLAY" || events[1] != "start FRIENDLY PLAY" {
+		t.Error("Expected our turn to end and theirs to start:", events)
+	}
+}
+
+func TestOpponentPerspectiveHeroPower(t *testing.T) {
+	gs := createEmptyGameState()
+	theirs := gs.CreateNewMinion("CS2_034", "OPPOSING PLAY (Hero Power)") // Fireblast
+	theirs.Exhausted = true
+	gs.ManaMax = 10
+
+	result := gs.OpponentPerspective()
+	heroPower := getSingletonFromZone(result, "FRIENDLY PLAY (Hero Power)", false)
+	if heroPower == nil || heroPower.Exhausted {
+		t.Fatal("Expected their hero power to be ready:", heroPower)
+	}
+	if result.ManaMax != heroPower.Cost || result.ManaMax == 0 {
+		t.Error("Expected just enough mana for the hero power, got", result.ManaMax)
+	}
+}
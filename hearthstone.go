@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/ActiveState/tail"
+	"os"
 	"strings"
 	"time"
 )
@@ -19,54 +21,184 @@ func prettyPrintDecisionTreeNode(node *DecisionTreeNode) {
 		fmt.Println("nil")
 		return
 	}
+	if node.SuccessProbability < 1 {
+		fmt.Printf("Lethal with %.0f%% probability if you draw %v", node.SuccessProbability*100, strings.Join(getDraws(node), ", then "))
+		if node.LineProbability > node.SuccessProbability {
+			fmt.Printf(" (%.0f%% with any of the draws that win after these moves)", node.LineProbability*100)
+		}
+		fmt.Println(":")
+	}
 	for i, move := range node.Moves {
 		fmt.Printf("%v.  %v\n", i+1, move.Description)
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replayMain(os.Args[2:]))
+		case "solve":
+			os.Exit(solveMain(os.Args[2:]))
+		case "coverage":
+			os.Exit(coverageMain(os.Args[2:]))
+		}
+	}
+	watchMain()
+}
+
+// Follows the live log file and looks for lethal as the game goes on.
+func watchMain() {
 	hsLogFile := flag.String("log", "no-log-file-specified", "The file path to the Hearthstone log file.")
-	hsUsername := flag.String("username", "no-username-specified", "Your battlenet ID (without the #1234).")
+	hsUsername := flag.String("username", "", "Optional. Your battlenet ID (without the #1234), to help identify which player you are.")
+	saveStates := flag.String("save_states", "", "Optional. Save a GameState snapshot into this directory at the start of each of your turns.")
+	opponentAnalysis := flag.Bool("opponent_analysis", false, "During the opponent's turn, check whether they have lethal on board next turn.")
+	deck := flag.String("deck", "", "Optional. Your decklist: a deck code, or a file with a deck code or one card per line.")
+	workers := flag.Int("workers", 0, "Optional. How many nodes to expand at once. Defaults to the number of CPUs; lower it if the game stutters.")
+	maxMemoryMb := flag.Uint64("max_memory_mb", DEFAULT_MAX_MEMORY>>20, "Give up searching once the whole process uses this much memory. 0 for no limit.")
+	cards := addCardsFlag(flag.CommandLine)
+	effects := addEffectsFlag(flag.CommandLine)
 
 	flag.Parse()
+	if !loadCardDatabase(*cards) || !loadCardEffects(*effects) {
+		os.Exit(1)
+	}
 
-	createManaUpdateParser(*hsUsername)
+	SetLocalUsername(*hsUsername)
 	log, _ := tail.TailFile(*hsLogFile, tail.Config{Follow: true})
 
 	gs := GameState{}
 	gs.resetGameState()
-	solutionChan := make(chan *DecisionTreeNode)
-	seenUsername := false
+	if *deck != "" {
+		if deckList, err := LoadDeckList(*deck); err != nil {
+			fmt.Println("ERROR: Cannot load decklist:", err.Error())
+		} else {
+			gs.SetDeckList(deckList)
+		}
+	}
+	// A live turn lasts 75 seconds at most, so there's no point going on any
+	// longer than that.
+	solver := NewSolver(SolverOptions{
+		Deadline:  75 * time.Second,
+		Workers:   *workers,
+		MaxMemory: maxMemoryFromMb(*maxMemoryMb),
+		Verbose:   true,
+	})
+	var search *Search
+	// Only one of these is set at a time, depending on whose turn we're solving.
+	var solutionChan, dangerChan <-chan *DecisionTreeNode
 	var deepestSolution, shortestSolution *DecisionTreeNode
-	var abortChan *chan time.Time
+	var likeliestChance float32 // Of the lines that need a lucky draw, since the last solve started.
+	lineChances := NewLineChances()
+	var cancelSearch, cancelWarnings context.CancelFunc
+	tracker := NewLethalTracker()
+	var solvingTurn int32
 	for {
 		select {
 		case line := <-log.Lines:
-			if !seenUsername && strings.Contains(line.Text, *hsUsername) {
-				seenUsername = true
+			if report := tracker.BeforeLine(line.Text, &gs); report != nil {
+				prettyPrintGameReport(report)
+			}
+			turnStart, somethingHappened, playerIdentified := ParseHearthstoneLogLine(line.Text, &gs)
+			if report := tracker.AfterLine(&gs); report != nil {
+				prettyPrintGameReport(report)
+			}
+			if playerIdentified {
+				fmt.Println("INFO: Identified the local player, looking for solutions from now on.")
 			}
-			if turnStart, somethingHappened := ParseHearthstoneLogLine(line.Text, &gs); turnStart || somethingHappened {
-				if !seenUsername {
-					fmt.Println("WARN: Waiting to see --username before looking for solutions.")
+			if turnStart && gs.IsFriendlyMainPhase() && *saveStates != "" {
+				saveTurnSnapshot(*saveStates, tracker.Game, &gs)
+			}
+			if turnStart || somethingHappened {
+				if gs.LocalPlayerId == 0 {
+					fmt.Println("WARN: Waiting to identify the local player before looking for solutions.")
+					continue
+				}
+				if !gs.IsFriendlyMainPhase() && !(turnStart && *opponentAnalysis) {
+					// Nothing we can do until it is our turn again. Our
+					// search (but not one into the opponent's turn) is moot.
+					if solutionChan != nil {
+						cancelSearch()
+						solutionChan = nil
+						if cancelWarnings != nil {
+							cancelWarnings()
+						}
+					}
 					continue
 				}
-				//fmt.Println("It is the start of turn for:", gs.LastManaAdjustPlayer)
-				if abortChan != nil {
-					*abortChan <- time.Now()
-					abortChan = nil
+				//fmt.Println("It is the start of turn for:", gs.CurrentPlayerId)
+				if cancelSearch != nil {
+					cancelSearch()
 					deepestSolution = nil
 					shortestSolution = nil
+					likeliestChance = 0
+					lineChances = NewLineChances()
 				}
-				newAbortChan := make(chan time.Time, 1)
-				abortChan = &newAbortChan
-				go WalkDecisionTree(gs.DeepCopy(), solutionChan, newAbortChan)
+				var ctx context.Context
+				ctx, cancelSearch = context.WithCancel(context.Background())
+				solutionChan, dangerChan = nil, nil
+				if gs.IsFriendlyMainPhase() {
+					solvingTurn = gs.Turn
+					search = solver.Solve(ctx, gs.DeepCopy())
+					solutionChan = search.Solutions
+					if turnStart {
+						if cancelWarnings != nil {
+							cancelWarnings()
+						}
+						var warningsCtx context.Context
+						warningsCtx, cancelWarnings = context.WithCancel(context.Background())
+						go warnAsTurnEnds(warningsCtx)
+					}
+				} else {
+					fmt.Printf("INFO: Turn %v is the opponent's, checking whether they have lethal next turn.\n", gs.Turn)
+					search = solver.Solve(ctx, gs.OpponentPerspective())
+					dangerChan = search.Solutions
+				}
+			}
+		case danger, ok := <-dangerChan:
+			if !ok {
+				dangerChan = nil
+				if deepestSolution == nil && search.Wait().Exhausted() {
+					fmt.Println("INFO: The opponent has no lethal on board next turn.")
+				}
+				continue
+			}
+			if deepestSolution == nil {
+				deepestSolution = danger
+				fmt.Println("WARN: The opponent has lethal on board next turn:")
+				prettyPrintDecisionTreeNode(danger)
+			}
+		case solution, ok := <-solutionChan:
+			if !ok {
+				solutionChan = nil
+				if deepestSolution == nil {
+					// Say so, so the player can stop waiting and plan a value turn.
+					stats := search.Wait()
+					if likeliestChance > 0 {
+						fmt.Printf("INFO: No guaranteed lethal (best %.0f%% with a draw) in %v nodes (stopped: %v).\n",
+							likeliestChance*100, stats.NodesExplored, stats.StoppedBy)
+					} else {
+						fmt.Println("INFO:", describeNoLethal(stats))
+					}
+				}
+				continue
+			}
+			if solution.SuccessProbability < 1 {
+				solution.LineProbability = lineChances.Add(solution)
+				// Only worth mentioning while there's nothing better.
+				if deepestSolution == nil && solution.LineProbability > likeliestChance {
+					likeliestChance = solution.LineProbability
+					fmt.Println("INFO: Possible solution")
+					prettyPrintDecisionTreeNode(solution)
+				}
+				continue
 			}
-		case solution := <-solutionChan:
 			if deepestSolution == nil {
 				deepestSolution = solution
 				shortestSolution = solution
 				fmt.Println("INFO: Solution found")
 				prettyPrintDecisionTreeNode(solution)
+				tracker.AddSolution(solvingTurn, solution)
 			}
 			if len(deepestSolution.Moves) < len(solution.Moves) {
 				deepestSolution = solution
@@ -81,3 +213,22 @@ func main() {
 		}
 	}
 }
+
+// Counts down the turn timer from the start of our turn, until ctx is done.
+func warnAsTurnEnds(ctx context.Context) {
+	for _, warning := range []struct {
+		after   time.Duration
+		message string
+	}{
+		{30 * time.Second, "WARN: Turn ends in 40 seconds."},
+		{20 * time.Second, "WARN: Turn ends in 20 seconds."},
+		{20 * time.Second, "WARN: Turn ended."},
+	} {
+		select {
+		case <-time.After(warning.after):
+			fmt.Println(warning.message)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
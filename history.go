@@ -0,0 +1,117 @@
+// The structured history of what happened in a game, from the action blocks
+// in the log.
+
+package main
+
+import "fmt"
+
+// One BLOCK_START/BLOCK_END (ACTION_START/ACTION_END in older logs) block:
+// an attack, a card being played, a trigger, a deathrattle, etc.
+type Action struct {
+	Type        string // BlockType, e.g. "ATTACK", "PLAY", "TRIGGER", "DEATHS", "POWER".
+	Source      string // The raw Entity= from the log.
+	SourceId    int32  // InstanceId of the source, or 0 if it isn't a card (e.g. GameEntity).
+	Target      string // The raw Target= from the log.
+	TargetId    int32  // InstanceId of the target, or 0 if there is none.
+	Turn        int32  // GameState.Turn when the block started.
+	TagChanges  []TagChange
+	ZoneChanges []ZoneChange
+	Children    []*Action
+	parent      *Action
+}
+
+// A TAG_CHANGE seen directly inside an Action.
+type TagChange struct {
+	Entity   string // The raw Entity= from the log.
+	EntityId int32  // InstanceId, or 0 if it isn't a card.
+	Tag      string
+	Value    string
+}
+
+// A card changing ZONE tag inside an Action. From is "" for newly created cards.
+type ZoneChange struct {
+	InstanceId int32
+	From       string
+	To         string
+}
+
+// Calls f on this action and all of its descendants, parents first.
+func (a *Action) walk(f func(*Action)) {
+	f(a)
+	for _, child := range a.Children {
+		child.walk(f)
+	}
+}
+
+// All actions (at any depth) of the given BlockType that started on the given
+// turn, in log order. An empty blockType matches everything.
+func (gs *GameState) FindActions(turn int32, blockType string) []*Action {
+	result := make([]*Action, 0)
+	for _, action := range gs.Actions {
+		action.walk(func(a *Action) {
+			if a.Turn == turn && (blockType == "" || a.Type == blockType) {
+				result = append(result, a)
+			}
+		})
+	}
+	return result
+}
+
+// The cards the given player played on the given turn, in order.
+func (gs *GameState) CardsPlayed(playerId int32, turn int32) []*Card {
+	result := make([]*Card, 0)
+	for _, action := range gs.FindActions(turn, "PLAY") {
+		if card, ok := gs.CardsById[action.SourceId]; ok && card.Controller == playerId {
+			result = append(result, card)
+		}
+	}
+	return result
+}
+
+// The attacks the given player made on the given turn, in order.
+func (gs *GameState) Attacks(playerId int32, turn int32) []*Action {
+	result := make([]*Action, 0)
+	for _, action := range gs.FindActions(turn, "ATTACK") {
+		if card, ok := gs.CardsById[action.SourceId]; ok && card.Controller == playerId {
+			result = append(result, action)
+		}
+	}
+	return result
+}
+
+// A short human-readable description, e.g. "Frothing Berserker attacks Thrall".
+func (a *Action) Describe(gs *GameState) string {
+	source := gs.getEntityName(a.SourceId, a.Source)
+	target := gs.getEntityName(a.TargetId, a.Target)
+	switch a.Type {
+	case "ATTACK":
+		return fmt.Sprintf("%v attacks %v", source, target)
+	case "PLAY":
+		if a.TargetId != 0 {
+			return fmt.Sprintf("Play %v on %v", source, target)
+		}
+		return fmt.Sprintf("Play %v", source)
+	}
+	return fmt.Sprintf("%v (%v)", source, a.Type)
+}
+
+// The moves (plays and attacks) the given player made on the given turn.
+func (gs *GameState) DescribeMoves(playerId int32, turn int32) []string {
+	result := make([]string, 0)
+	for _, action := range gs.Actions {
+		if action.Turn != turn || (action.Type != "PLAY" && action.Type != "ATTACK") {
+			continue
+		}
+		if card, ok := gs.CardsById[action.SourceId]; ok && card.Controller == playerId {
+			result = append(result, action.Describe(gs))
+		}
+	}
+	return result
+}
+
+func (gs *GameState) getEntityName(instanceId int32, raw string) string {
+	if card, ok := gs.CardsById[instanceId]; ok && card.Name != "" {
+		return card.Name
+	}
+	return raw
+}
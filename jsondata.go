@@ -3,23 +3,40 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 // The source of truth for what a card looks like in its default state.
+// Both file formats are read into this, using the legacy AllSets.json
+// spellings, e.g. Type "Hero Power" and mechanic "Divine Shield".
 type JsonCardData struct {
-	Id        string   `json:"id"`
-	Name      string   `json:"name"`
-	Type      string   `json:"type"`
-	Text      string   `json:"text"`
-	Cost      int32    `json:"cost"`
-	Attack    int32    `json:"attack"`
-	Health    int32    `json:"health"`
-	Mechanics []string `json:"mechanics"`
+	Id             string   `json:"id"`
+	Name           string   `json:"name"`
+	Type           string   `json:"type"`
+	Text           string   `json:"text"`
+	Cost           int32    `json:"cost"`
+	Attack         int32    `json:"attack"`
+	Health         int32    `json:"health"`
+	Durability     int32    `json:"durability"`
+	Mechanics      []string `json:"mechanics"`
+	DbfId          int32    `json:"dbfId"` // What deckstrings refer to cards by. Only in cards.json.
+	Collectible    bool     `json:"collectible"`
+	Set            string   `json:"set"` // For AllSets.json, the name of the set it was listed under.
+	Race           string   `json:"race"`
+	Overload       int32    `json:"overload"`
+	SpellDamage    int32    `json:"spellDamage"`
+	ReferencedTags []string `json:"referencedTags"`
 }
 
+// Neither of these has its own entry in "mechanics".
+var spellDamageTextPattern = regexp.MustCompile(`Spell Damage \+(\d+)`)
+var cantBeTargetedTextPattern = regexp.MustCompile(`(?m)^Can't be targeted by spells or Hero Powers`)
+
 func newCardFromJson(jsonCardId string, instanceId int32) Card {
 	if jsonCard, ok := GlobalCardJsonData[jsonCardId]; ok {
 		result := Card{
@@ -30,69 +47,105 @@ func newCardFromJson(jsonCardId string, instanceId int32) Card {
 			Cost:       jsonCard.Cost,
 			Attack:     jsonCard.Attack,
 			Health:     jsonCard.Health,
+			Durability: jsonCard.Durability,
 		}
 		for _, mechanic := range jsonCard.Mechanics {
 			switch mechanic {
 			case "Taunt":
 				result.Taunt = true
+			case "Charge":
+				result.Charge = true
+			case "Divine Shield":
+				result.DivineShield = true
+			case "Windfury":
+				result.Windfury = true
+			case "Stealth":
+				result.Stealth = true
+			case "Poisonous":
+				result.Poisonous = true
+			case "Spellpower":
+				result.SpellPower = 1
+				if jsonCard.SpellDamage > 0 {
+					result.SpellPower = jsonCard.SpellDamage
+				} else if match := spellDamageTextPattern.FindStringSubmatch(jsonCard.Text); match != nil {
+					spellPower, _ := strconv.ParseInt(match[1], 10, 32)
+					result.SpellPower = int32(spellPower)
+				}
 			default:
 				//fmt.Printf("WARN: Unknown json card mechanic %v\n", mechanic)
 			}
 		}
+		if cantBeTargetedTextPattern.MatchString(jsonCard.Text) {
+			result.CantBeTargetedBySpells = true
+			result.CantBeTargetedByHeroPowers = true
+		}
 		return result
 	}
-	fmt.Printf("ERROR: Unknown jsonCardId: %v\n", jsonCardId)
+	if jsonCardId != "" {
+		// Hidden cards (e.g. the opponent's hand) legitimately have no id.
+		fmt.Printf("ERROR: Unknown jsonCardId: %v\n", jsonCardId)
+	}
 	return Card{
 		InstanceId: instanceId,
 		JsonCardId: jsonCardId,
 		Exhausted:  true}
 }
 
-var GlobalCardJsonData map[string]JsonCardData
-
-func loadCardJson() {
-	GlobalCardJsonData = make(map[string]JsonCardData)
-	var jsonFileData struct {
-		Basic     []JsonCardData `json:"Basic"`
-		Classic   []JsonCardData `json:"Classic"`
-		Nax       []JsonCardData `json:"Curse of Naxxramas"`
-		Brm       []JsonCardData `json:"Blackrock Mountain"`
-		Promotion []JsonCardData `json:"Promotion"`
-		Reward    []JsonCardData `json:"Reward"`
-		Gvg       []JsonCardData `json:"Goblins vs Gnomes"`
-		Tb        []JsonCardData `json:"Tavern Brawl"`
-	}
-	cardFile, _ := os.Open("AllSets.json")
-	jsonParser := json.NewDecoder(cardFile)
-	if err := jsonParser.Decode(&jsonFileData); err != nil {
-		fmt.Println("ERROR: Cannot parse json card data: ", err.Error())
-	}
-	for _, card := range jsonFileData.Basic {
-		GlobalCardJsonData[card.Id] = card
-	}
-	for _, card := range jsonFileData.Classic {
-		GlobalCardJsonData[card.Id] = card
-	}
-	for _, card := range jsonFileData.Nax {
-		GlobalCardJsonData[card.Id] = card
-	}
-	for _, card := range jsonFileData.Brm {
-		GlobalCardJsonData[card.Id] = card
+// Reads either the flat array of cards.json from HearthstoneJSON, or the
+// legacy AllSets.json object of arrays keyed by set name.
+func parseCardJson(data []byte) (map[string]JsonCardData, error) {
+	result := make(map[string]JsonCardData)
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var cards []JsonCardData
+		if err := json.Unmarshal(trimmed, &cards); err != nil {
+			return nil, err
+		}
+		for _, card := range cards {
+			result[card.Id] = normalizeCardJson(card)
+		}
+		return result, nil
 	}
-	for _, card := range jsonFileData.Promotion {
-		GlobalCardJsonData[card.Id] = card
+	var sets map[string][]JsonCardData
+	if err := json.Unmarshal(trimmed, &sets); err != nil {
+		return nil, err
 	}
-	for _, card := range jsonFileData.Reward {
-		GlobalCardJsonData[card.Id] = card
+	for set, cards := range sets {
+		for _, card := range cards {
+			card.Set = set
+			result[card.Id] = card
+		}
 	}
-	for _, card := range jsonFileData.Gvg {
-		GlobalCardJsonData[card.Id] = card
+	return result, nil
+}
+
+// Turns cards.json's spellings (e.g. "HERO_POWER", "DIVINE_SHIELD") into
+// the AllSets.json ones the rest of the code expects.
+func normalizeCardJson(card JsonCardData) JsonCardData {
+	card.Type = normalizeCardJsonName(card.Type)
+	card.Race = normalizeCardJsonName(card.Race)
+	mechanics := make([]string, len(card.Mechanics))
+	for i, mechanic := range card.Mechanics {
+		mechanics[i] = normalizeCardJsonName(mechanic)
 	}
-	for _, card := range jsonFileData.Tb {
-		GlobalCardJsonData[card.Id] = card
+	card.Mechanics = mechanics
+	referencedTags := make([]string, len(card.ReferencedTags))
+	for i, tag := range card.ReferencedTags {
+		referencedTags[i] = normalizeCardJsonName(tag)
 	}
+	card.ReferencedTags = referencedTags
+	// Marks text the client should lay out itself.
+	card.Text = strings.TrimPrefix(card.Text, "[x]")
+	return card
 }
 
-func init() {
-	loadCardJson()
+// "DIVINE_SHIELD" -> "Divine Shield".
+func normalizeCardJsonName(name string) string {
+	words := strings.Split(strings.ToLower(name), "_")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
 }
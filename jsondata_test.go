@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	if !loadCardDatabase("") {
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestParseModernCardJson(t *testing.T) {
+	cards, err := parseCardJson([]byte(`[
+		{"id": "EX1_008", "dbfId": 757, "name": "Argent Squire", "type": "MINION", "set": "EXPERT1",
+		 "cost": 1, "attack": 1, "health": 1, "mechanics": ["DIVINE_SHIELD"], "collectible": true},
+		{"id": "EX1_563", "dbfId": 303, "name": "Malygos", "type": "MINION", "race": "DRAGON",
+		 "text": "[x]<b>Spell Damage +5</b>", "mechanics": ["SPELLPOWER"], "spellDamage": 5},
+		{"id": "CS2_102", "dbfId": 725, "name": "Armor Up!", "type": "HERO_POWER", "referencedTags": ["ARMOR"]},
+		{"id": "EX1_238", "dbfId": 1, "name": "Lightning Bolt", "type": "SPELL", "overload": 1}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	squire := cards["EX1_008"]
+	if squire.Type != "Minion" || squire.DbfId != 757 || squire.Set != "EXPERT1" || squire.Mechanics[0] != "Divine Shield" || !squire.Collectible {
+		t.Error("Argent Squire not normalized:", squire)
+	}
+	if malygos := cards["EX1_563"]; malygos.Race != "Dragon" || malygos.SpellDamage != 5 || malygos.Text != "<b>Spell Damage +5</b>" {
+		t.Error("Malygos not normalized:", malygos)
+	}
+	if armorUp := cards["CS2_102"]; armorUp.Type != "Hero Power" || armorUp.ReferencedTags[0] != "Armor" {
+		t.Error("Armor Up! not normalized:", armorUp)
+	}
+	if bolt := cards["EX1_238"]; bolt.Type != "Spell" || bolt.Overload != 1 {
+		t.Error("Lightning Bolt not normalized:", bolt)
+	}
+}
+
+func TestNewCardFromJsonKeywords(t *testing.T) {
+	if wolfrider := newCardFromJson("CS2_124", 1); !wolfrider.Charge {
+		t.Error("Wolfrider should have Charge:", wolfrider)
+	}
+	if squire := newCardFromJson("EX1_008", 2); !squire.DivineShield || squire.Charge {
+		t.Error("Argent Squire should only have Divine Shield:", squire)
+	}
+}
+
+func TestParseLegacyCardJson(t *testing.T) {
+	cards, err := parseCardJson([]byte(`{"Some New Set": [{"id": "NEW_001", "name": "New Card", "type": "Minion"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card := cards["NEW_001"]; card.Name != "New Card" || card.Set != "Some New Set" {
+		t.Error("Card from an unknown set not loaded:", card)
+	}
+	if _, err := parseCardJson([]byte(`not json`)); err == nil {
+		t.Error("Expected an error for bad json")
+	}
+}
+
+func TestNewCardDatabase(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewCardDatabase(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte(`[{"id": "EX1_008",`), 0644)
+	if _, err := NewCardDatabase(corrupt); err == nil {
+		t.Error("Expected an error for a corrupt file")
+	}
+	empty := filepath.Join(dir, "empty.json")
+	os.WriteFile(empty, []byte(`{}`), 0644)
+	if _, err := NewCardDatabase(empty); err == nil {
+		t.Error("Expected an error for a file without cards")
+	}
+
+	good := filepath.Join(dir, "cards.json")
+	os.WriteFile(good, []byte(`[{"id": "A", "name": "Alpha", "set": "CORE"}, {"id": "B", "name": "Beta", "set": "CORE"},
+		{"id": "C", "name": "Gamma", "set": "EXPERT1"}]`), 0644)
+	t.Setenv(CARDS_ENV_VAR, good)
+	db, err := NewCardDatabase("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary := db.Summary(); !strings.HasSuffix(summary, "3 cards from "+good+": CORE 2, EXPERT1 1") {
+		t.Error("Unexpected summary:", summary)
+	}
+}
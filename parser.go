@@ -6,38 +6,90 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 var (
-	startTurnPattern = regexp.MustCompile(`Entity=GameEntity tag=STEP value=MAIN_ACTION`)
-	lineParsers      = []LineParser{
-		LineParser{applyNewGame, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
-			`CREATE_GAME`)},
+	newGamePattern = regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+		`CREATE_GAME`)
+	// The indented `tag=... value=...` children of an entity block.
+	entityBlockTagPattern = regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+		`tag=(?P<tag_name>\S+) value=(?P<tag_value>.*?)\r?$`)
+	// Any TAG_CHANGE, for recording into the open Action.
+	anyTagChangePattern = regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+		`TAG_CHANGE Entity=(?P<entity>.*) tag=(?P<tag_name>\S+) value=(?P<tag_value>.*?)\r?$`)
+	// Pulls the instance id out of either `[name=... id=42 ...]` or a bare `42`.
+	entityIdPattern = regexp.MustCompile(`^(?:\[.*\bid=(?P<instance_id>\d+).*\]|(?P<bare_id>\d+))$`)
+	lineParsers     = []LineParser{
+		LineParser{applyNewGame, newGamePattern},
+		LineParser{applyGameEntity, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`GameEntity EntityID=(?P<entity_id>\d+)\r?$`)},
+		LineParser{applyCreatePlayer, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`Player EntityID=(?P<entity_id>\d+) PlayerID=(?P<player_id>\d+) GameAccountId=(?P<game_account_id>.*?)\r?$`)},
+		LineParser{applyBlockStart, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`BLOCK_START BlockType=(?P<block_type>\S+) Entity=(?P<entity>.*?) EffectCardId=.* Target=(?P<target>.*?)(?: SubOption=.*)?\r?$`)},
+		LineParser{applyBlockStart, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`ACTION_START Entity=(?P<entity>.*?) (?:BlockType|PowerType)=(?P<block_type>\S+) Index=\S+ Target=(?P<target>.*?)\r?$`)},
+		LineParser{applyBlockEnd, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`(?:BLOCK|ACTION)_END\s*\r?$`)},
+		LineParser{applyFullEntity, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`FULL_ENTITY - Creating ID=(?P<instance_id>\d+) CardID=(?P<class_id>\S*)\r?$`)},
+		LineParser{applyShowEntity, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`SHOW_ENTITY - Updating Entity=(?P<entity>.*) CardID=(?P<class_id>\S+)\r?$`)},
+		LineParser{applyChangeEntity, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`CHANGE_ENTITY - Updating Entity=(?P<entity>.*) CardID=(?P<class_id>\S+)\r?$`)},
+		LineParser{applyHideEntity, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`HIDE_ENTITY - Entity=(?P<entity>.*) tag=(?P<tag_name>\S+) value=(?P<tag_value>.*?)\r?$`)},
+		LineParser{applyEntityTagChange, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`TAG_CHANGE Entity=(?P<entity>\[.*\]) tag=(?P<tag_name>CARDTYPE|CONTROLLER|ZONE|ZONE_POSITION) value=(?P<tag_value>.*?)\r?$`)},
 		LineParser{applyTagChange, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
-			`TAG_CHANGE .*id=(?P<instance_id>\d+).*cardId=(?P<class_id>\S+).*tag=(?P<tag_name>ATK|ARMOR|COST|DAMAGE|FROZEN|HEALTH|TAUNT|SILENCED) value=(?P<tag_value>.*?)\r?$`)},
+			`TAG_CHANGE .*id=(?P<instance_id>\d+).*cardId=(?P<class_id>\S+).*tag=(?P<tag_name>ATK|ARMOR|CANT_BE_TARGETED_BY_ABILITIES|CANT_BE_TARGETED_BY_HERO_POWERS|CANT_BE_TARGETED_BY_SPELLS|COST|DAMAGE|DIVINE_SHIELD|DURABILITY|FROZEN|HEALTH|IMMUNE|POISONOUS|SPELLPOWER|STEALTH|TAUNT|SILENCED|WINDFURY) value=(?P<tag_value>.*?)\r?$`)},
 		LineParser{applyTagChangeNoJsonId, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
-			`TAG_CHANGE .*id=(?P<instance_id>\d+).*tag=(?P<tag_name>ATK|ARMOR|CHARGE|COST|DAMAGE|EXHAUSTED|FROZEN|HEALTH|NUM_ATTACKS_THIS_TURN|TAUNT|SILENCED) value=(?P<tag_value>.*?)\r?$`)},
+			`TAG_CHANGE .*id=(?P<instance_id>\d+).*tag=(?P<tag_name>ATK|ARMOR|CANT_BE_TARGETED_BY_ABILITIES|CANT_BE_TARGETED_BY_HERO_POWERS|CANT_BE_TARGETED_BY_SPELLS|CHARGE|COST|DAMAGE|DIVINE_SHIELD|DURABILITY|EXHAUSTED|FROZEN|HEALTH|IMMUNE|NUM_ATTACKS_THIS_TURN|POISONOUS|SPELLPOWER|STEALTH|TAUNT|SILENCED|WINDFURY) value=(?P<tag_value>.*?)\r?$`)},
 		//LineParser{applyDebugWriteLine, regexp.MustCompile(`\[Zone\] ZoneChangeList.ProcessChanges\(\) -\s+` +
 		//  `id=.* local=.* \[name=(?P<name>.*) id=(?P<instanceId>.*) zone=.* zonePos=.* cardId=(?P<class_id>.*) player=(?P<player_id>.*)\] zone from (?P<zome_from>.*) -> (?P<zome_to>.*)`)},
 		LineParser{applyZoneChange, regexp.MustCompile(`\[Zone\] ZoneChangeList.ProcessChanges\(\) -\s+` +
 			`TRANSITIONING card \[name=(?P<name>.*) id=(?P<instance_id>.*) zone=.* zonePos=.* cardId=(?P<class_id>.*) player=(?P<player_id>.*)\] to (?P<zone_to>.*?)\r?$`)},
+		LineParser{applyGameEntityTagChange, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`TAG_CHANGE Entity=GameEntity tag=(?P<tag_name>NEXT_STEP|STEP|TURN) value=(?P<tag_value>\S+?)\r?$`)},
+		LineParser{applyPlayerTagChange, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
+			`TAG_CHANGE Entity=(?P<player_name>[^\[\]]+?) tag=(?P<tag_name>CURRENT_PLAYER|FIRST_PLAYER|PLAYER_ID|PLAYSTATE|RESOURCES|RESOURCES_USED|TEMP_RESOURCES) value=(?P<tag_value>\w+)\r?$`)},
+		LineParser{applyZonePositionChange, regexp.MustCompile(`\[Zone\] ZoneChangeList.ProcessChanges\(\) -\s+` +
+			`id=.* local=.* \[name=.* id=(?P<instance_id>\d+) zone=.* zonePos=.* cardId=.* player=.*\] pos from (?P<pos_from>\d+) -> (?P<pos_to>\d+)\r?$`)},
 		//LineParser{regexp.MustCompile(`\[Power\] .*`), applyDebugWriteLine},
 	}
+	// Optional battletag (without the #1234) of the local player. Only used as
+	// a hint for which player is friendly; the log is usually enough.
+	localUsername string
 )
 
-func createManaUpdateParser(username string) {
-	lineParsers = append(lineParsers, LineParser{applyManaUpdate, regexp.MustCompile(`\[Power\] GameState.DebugPrintPower\(\) -\s+` +
-		`TAG_CHANGE Entity=` + username + ` tag=(?P<tag_name>RESOURCES|RESOURCES_USED|TEMP_RESOURCES) value=(?P<mana>\d+)`)})
+func SetLocalUsername(username string) {
+	localUsername = username
 }
 
 // Consumes a Hearthstone log line.
-// turnStart -- Did this line indicate a player's turn just began?
+// turnStart -- Did this line indicate a player's turn just began? Check gs.CurrentPlayerId for whose.
 // somethingHappened -- Did this line indicate anything relevant happened?
-func ParseHearthstoneLogLine(line string, gs *GameState) (turnStart bool, somethingHappened bool) {
-	if match := startTurnPattern.FindStringSubmatch(line); len(match) > 0 {
-		turnStart = true
-		return
+// playerIdentified -- Did this line tell us for the first time which player is friendly?
+func ParseHearthstoneLogLine(line string, gs *GameState) (turnStart bool, somethingHappened bool, playerIdentified bool) {
+	if gs.LocalPlayerId == 0 {
+		defer func() { playerIdentified = gs.LocalPlayerId != 0 }()
+	}
+	if gs.openBlock != nil {
+		if match := getLineGroups(line, entityBlockTagPattern); match != nil {
+			somethingHappened = gs.openBlock(match["tag_name"], match["tag_value"])
+			return
+		}
+		// Any other line means the block is over.
+		gs.openBlock = nil
 	}
+	if gs.openAction != nil {
+		if match := getLineGroups(line, anyTagChangePattern); match != nil {
+			gs.openAction.recordTagChange(match["entity"], match["tag_name"], match["tag_value"])
+		}
+	}
+	stepBefore := gs.Step
+	defer func() { turnStart = gs.Step == "MAIN_ACTION" && stepBefore != "MAIN_ACTION" }()
 	parser, match := getMatchingParser(line, lineParsers)
 	if parser != nil {
 		if parser.applyFunc == nil {
@@ -79,8 +131,84 @@ func applyNewGame(args *LineParserApplyArgs) {
 	applyDebugWriteLine(args)
 }
 
+// The GameEntity block in CREATE_GAME.
+func applyGameEntity(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	gs := args.gs
+	gs.openBlock = func(tagName string, tagValue string) bool {
+		return gs.applyGameEntityTag(tagName, tagValue)
+	}
+}
+
+func applyGameEntityTagChange(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	args.gs.applyGameEntityTag(args.match["tag_name"], args.match["tag_value"])
+}
+
+// Applies one of the GameEntity's tags, which track the turn structure.
+// Returns false if the tag is not one we track.
+func (gs *GameState) applyGameEntityTag(tagName string, tagValue string) bool {
+	switch tagName {
+	case "TURN":
+		turn, _ := strconv.ParseInt(tagValue, 10, 32)
+		gs.Turn = int32(turn)
+	case "STEP":
+		gs.Step = tagValue
+	case "NEXT_STEP":
+		gs.NextStep = tagValue
+	default:
+		return false
+	}
+	return true
+}
+
+// Applies a turn-order or game-result tag to a player. These are mirrored
+// onto the GameState so the solver can see them.
+func (gs *GameState) applyPlayerTag(player *Player, tagName string, tagValue string) bool {
+	switch tagName {
+	case "CURRENT_PLAYER":
+		player.CurrentPlayer = tagValue == "1"
+		if player.CurrentPlayer {
+			gs.CurrentPlayerId = player.PlayerId
+		} else if gs.CurrentPlayerId == player.PlayerId {
+			gs.CurrentPlayerId = 0
+		}
+	case "FIRST_PLAYER":
+		if tagValue == "1" {
+			gs.FirstPlayerId = player.PlayerId
+		}
+	case "PLAYSTATE":
+		player.PlayState = tagValue
+		if gs.Winner != NO_VICTORY || gs.LocalPlayerId == 0 {
+			break
+		}
+		isLocal := player.PlayerId == gs.LocalPlayerId
+		switch {
+		case tagValue == "WON" && isLocal, tagValue == "LOST" && !isLocal:
+			gs.Winner = FRIENDLY_VICTORY
+		case tagValue == "WON", tagValue == "LOST", tagValue == "TIED":
+			gs.Winner = OPPOSING_VICTORY_OR_DRAW
+		}
+	default:
+		return false
+	}
+	return true
+}
+
 func applyCreatePlayer(args *LineParserApplyArgs) {
 	//applyDebugWriteLine(args)
+	entity_id, _ := strconv.ParseInt(args.match["entity_id"], 10, 32)
+	player_id, _ := strconv.ParseInt(args.match["player_id"], 10, 32)
+	player := &Player{
+		EntityId:      int32(entity_id),
+		PlayerId:      int32(player_id),
+		GameAccountId: args.match["game_account_id"],
+	}
+	gs := args.gs
+	gs.Players[player.PlayerId] = player
+	gs.openBlock = func(tagName string, tagValue string) bool {
+		return gs.applyPlayerTag(player, tagName, tagValue)
+	}
 }
 
 func applyZoneChange(args *LineParserApplyArgs) {
@@ -88,43 +216,287 @@ func applyZoneChange(args *LineParserApplyArgs) {
 	instance_id, _ := strconv.ParseInt(args.match["instance_id"], 10, 32)
 	card := args.gs.getOrCreateCard(args.match["class_id"], int32(instance_id))
 	args.gs.moveCard(card, args.match["zone_to"])
+	if args.gs.LocalPlayerId == 0 && strings.HasPrefix(args.match["zone_to"], "FRIENDLY ") {
+		// The client tells us outright whose card this is.
+		player_id, _ := strconv.ParseInt(args.match["player_id"], 10, 32)
+		args.gs.setLocalPlayer(int32(player_id))
+	}
 	//prettyPrint(*card)
 }
 
+// A card sliding left or right within its zone.
+func applyZonePositionChange(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	instance_id, _ := strconv.ParseInt(args.match["instance_id"], 10, 32)
+	if card, ok := args.gs.CardsById[int32(instance_id)]; ok {
+		position, _ := strconv.ParseInt(args.match["pos_to"], 10, 32)
+		card.ZonePosition = int32(position)
+	}
+}
+
 func applyTagChange(args *LineParserApplyArgs) {
 	applyDebugWriteLine(args)
 	instance_id, _ := strconv.ParseInt(args.match["instance_id"], 10, 32)
 	card := args.gs.getOrCreateCard(args.match["class_id"], int32(instance_id))
-	//ATK|COST|DAMAGE|EXHAUSTED|FROZEN|HEALTH|TAUNT|SILENCED
-	tag_value_str, _ := strconv.ParseInt(args.match["tag_value"], 10, 32)
-	tag_value := int32(tag_value_str)
-	switch args.match["tag_name"] {
+	if !applyCardTag(card, args.match["tag_name"], args.match["tag_value"]) {
+		fmt.Println("ERROR: Unknown tag_name:", args.match["tag_name"])
+	}
+	//prettyPrint(*card)
+}
+
+// Applies a single `tag=... value=...` pair to a card.
+// Returns false if the tag is not one we track.
+func applyCardTag(card *Card, tagName string, tagValueStr string) bool {
+	tag_value_int, _ := strconv.ParseInt(tagValueStr, 10, 32)
+	tag_value := int32(tag_value_int)
+	switch tagName {
 	case "ATK":
 		card.Attack = tag_value
 	case "ARMOR":
 		card.Armor = tag_value
+	case "CANT_BE_TARGETED_BY_ABILITIES", "CANT_BE_TARGETED_BY_SPELLS":
+		// Older logs call spells "abilities".
+		card.CantBeTargetedBySpells = tag_value == 1
+	case "CANT_BE_TARGETED_BY_HERO_POWERS":
+		card.CantBeTargetedByHeroPowers = tag_value == 1
 	case "CHARGE":
 		card.Charge = tag_value == 1
 	case "COST":
 		card.Cost = tag_value
+	case "CREATOR":
+		card.CreatorId = tag_value
 	case "DAMAGE":
 		card.Damage = tag_value
+	case "DIVINE_SHIELD":
+		card.DivineShield = tag_value == 1
+	case "DURABILITY":
+		card.Durability = tag_value
 	case "EXHAUSTED":
 		card.Exhausted = tag_value == 1
 	case "FROZEN":
 		card.Frozen = tag_value == 1
 	case "HEALTH":
 		card.Health = tag_value
+	case "IMMUNE":
+		card.Immune = tag_value == 1
 	case "NUM_ATTACKS_THIS_TURN":
 		card.NumAttacksThisTurn = tag_value
+	case "POISONOUS":
+		card.Poisonous = tag_value == 1
+	case "SPELLPOWER":
+		card.SpellPower = tag_value
+	case "STEALTH":
+		card.Stealth = tag_value == 1
 	case "TAUNT":
 		card.Taunt = tag_value == 1
 	case "SILENCED":
 		card.Silenced = tag_value == 1
+	case "WINDFURY":
+		card.Windfury = tag_value == 1
 	default:
-		fmt.Println("ERROR: Unknown tag_name:", args.match["tag_name"])
+		return false
+	}
+	return true
+}
+
+// Parses an `Entity=` reference into an instance id, if it names a card.
+func parseEntityId(entity string) (int32, bool) {
+	match := getLineGroups(entity, entityIdPattern)
+	if match == nil {
+		return 0, false
+	}
+	id_str := match["instance_id"]
+	if id_str == "" {
+		id_str = match["bare_id"]
+	}
+	instance_id, err := strconv.ParseInt(id_str, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(instance_id), true
+}
+
+// Opens a new Action, nested inside the current one if there is one.
+func applyBlockStart(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	gs := args.gs
+	action := &Action{
+		Type:   args.match["block_type"],
+		Source: args.match["entity"],
+		Target: args.match["target"],
+		Turn:   gs.Turn,
+		parent: gs.openAction,
+	}
+	action.SourceId, _ = parseEntityId(action.Source)
+	action.TargetId, _ = parseEntityId(action.Target)
+	if gs.openAction != nil {
+		gs.openAction.Children = append(gs.openAction.Children, action)
+	} else {
+		gs.Actions = append(gs.Actions, action)
+	}
+	gs.openAction = action
+}
+
+func applyBlockEnd(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	if args.gs.openAction == nil {
+		// We started reading the log in the middle of a block.
+		return
+	}
+	args.gs.openAction = args.gs.openAction.parent
+}
+
+func (a *Action) recordTagChange(entity string, tagName string, tagValue string) {
+	entityId, _ := parseEntityId(entity)
+	a.TagChanges = append(a.TagChanges, TagChange{
+		Entity:   entity,
+		EntityId: entityId,
+		Tag:      tagName,
+		Value:    tagValue,
+	})
+}
+
+// FULL_ENTITY introduces a card, possibly without telling us what it is.
+// Its child tag lines follow.
+func applyFullEntity(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	instance_id, _ := strconv.ParseInt(args.match["instance_id"], 10, 32)
+	card := args.gs.getOrCreateCard(args.match["class_id"], int32(instance_id))
+	if card.JsonCardId == "" && args.match["class_id"] != "" {
+		card.changeJsonCardId(args.match["class_id"])
+	}
+	if card.Type == "Hero Power" {
+		// The block only lists EXHAUSTED if it's been used already.
+		card.Exhausted = false
+	}
+	gs := args.gs
+	gs.openBlock = func(tagName string, tagValue string) bool {
+		applied := gs.applyEntityTag(card, tagName, tagValue)
+		if gs.LocalPlayerId == 0 && card.ZoneTag == "HAND" && card.JsonCardId != "" {
+			// Only the local player's new cards in hand are shown to us.
+			gs.setLocalPlayer(card.Controller)
+		}
+		return applied
+	}
+}
+
+// SHOW_ENTITY reveals a card we have seen before (e.g. drawn or played by
+// the opponent). Its child tag lines follow.
+func applyShowEntity(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	instance_id, ok := parseEntityId(args.match["entity"])
+	if !ok {
+		fmt.Println("ERROR: Cannot parse SHOW_ENTITY entity:", args.match["entity"])
+		return
+	}
+	card := args.gs.getOrCreateCard(args.match["class_id"], instance_id)
+	if card.JsonCardId != args.match["class_id"] {
+		card.changeJsonCardId(args.match["class_id"])
+	}
+	args.gs.openEntityBlock(card)
+}
+
+// CHANGE_ENTITY transforms a card into another one in place.
+// Its child tag lines follow.
+func applyChangeEntity(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	instance_id, ok := parseEntityId(args.match["entity"])
+	if !ok {
+		fmt.Println("ERROR: Cannot parse CHANGE_ENTITY entity:", args.match["entity"])
+		return
+	}
+	card := args.gs.getOrCreateCard(args.match["class_id"], instance_id)
+	card.changeJsonCardId(args.match["class_id"])
+	args.gs.openEntityBlock(card)
+}
+
+// HIDE_ENTITY is a single line that puts a card back out of sight.
+func applyHideEntity(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	instance_id, ok := parseEntityId(args.match["entity"])
+	if !ok {
+		return
+	}
+	if card, ok := args.gs.CardsById[instance_id]; ok {
+		args.gs.applyEntityTag(card, args.match["tag_name"], args.match["tag_value"])
+	}
+}
+
+// Reads the child tags of an entity block into the given card.
+func (gs *GameState) openEntityBlock(card *Card) {
+	gs.openBlock = func(tagName string, tagValue string) bool {
+		return gs.applyEntityTag(card, tagName, tagValue)
+	}
+}
+
+// Like applyCardTag, but also understands the tags that decide which zone
+// (and which side) a card belongs in.
+func (gs *GameState) applyEntityTag(card *Card, tagName string, tagValue string) bool {
+	defer gs.takeFromRemainingDeck(card)
+	switch tagName {
+	case "CARDTYPE":
+		if card.Type == "" {
+			card.Type = cardTypeNames[tagValue]
+		}
+	case "CONTROLLER":
+		controller, _ := strconv.ParseInt(tagValue, 10, 32)
+		card.Controller = int32(controller)
+		gs.updateZoneFromTags(card)
+	case "ZONE_POSITION":
+		position, _ := strconv.ParseInt(tagValue, 10, 32)
+		card.ZonePosition = int32(position)
+	case "ZONE":
+		if gs.openAction != nil && card.ZoneTag != tagValue {
+			gs.openAction.ZoneChanges = append(gs.openAction.ZoneChanges,
+				ZoneChange{InstanceId: card.InstanceId, From: card.ZoneTag, To: tagValue})
+		}
+		card.ZoneTag = tagValue
+		gs.updateZoneFromTags(card)
+	default:
+		return applyCardTag(card, tagName, tagValue)
+	}
+	return true
+}
+
+// Power log CARDTYPE values, as JsonCardData.Type.
+var cardTypeNames = map[string]string{
+	"HERO":        "Hero",
+	"HERO_POWER":  "Hero Power",
+	"MINION":      "Minion",
+	"SPELL":       "Spell",
+	"WEAPON":      "Weapon",
+	"ENCHANTMENT": "Enchantment",
+}
+
+// TAG_CHANGE of CARDTYPE/CONTROLLER/ZONE/ZONE_POSITION on a card.
+func applyEntityTagChange(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	instance_id, ok := parseEntityId(args.match["entity"])
+	if !ok {
+		return
+	}
+	if card, ok := args.gs.CardsById[instance_id]; ok {
+		args.gs.applyEntityTag(card, args.match["tag_name"], args.match["tag_value"])
+	}
+}
+
+// TAG_CHANGE on a player, who the log refers to by name.
+func applyPlayerTagChange(args *LineParserApplyArgs) {
+	applyDebugWriteLine(args)
+	player := args.gs.getPlayerByName(args.match["player_name"], args.match["tag_name"], args.match["tag_value"])
+	if player == nil {
+		return
+	}
+	tag_value_int, _ := strconv.ParseInt(args.match["tag_value"], 10, 32)
+	tag_value := int32(tag_value_int)
+	switch args.match["tag_name"] {
+	case "CURRENT_PLAYER", "FIRST_PLAYER", "PLAYSTATE":
+		args.gs.applyPlayerTag(player, args.match["tag_name"], args.match["tag_value"])
+	case "RESOURCES", "RESOURCES_USED", "TEMP_RESOURCES":
+		if player.PlayerId == args.gs.LocalPlayerId {
+			applyManaUpdate(args.gs, args.match["tag_name"], tag_value)
+		}
 	}
-	//prettyPrint(*card)
 }
 
 func applyTagChangeNoJsonId(args *LineParserApplyArgs) {
@@ -139,16 +511,14 @@ func applyTagChangeNoJsonId(args *LineParserApplyArgs) {
 	}
 }
 
-func applyManaUpdate(args *LineParserApplyArgs) {
-	applyDebugWriteLine(args)
-	mana_str, _ := strconv.ParseInt(args.match["mana"], 10, 32)
-	switch args.match["tag_name"] {
+func applyManaUpdate(gs *GameState, tagName string, mana int32) {
+	switch tagName {
 	case "RESOURCES":
-		args.gs.ManaMax = int32(mana_str)
+		gs.ManaMax = mana
 	case "RESOURCES_USED":
-		args.gs.ManaUsed = int32(mana_str)
+		gs.ManaUsed = mana
 	case "TEMP_RESOURCES":
-		args.gs.ManaTemp = int32(mana_str)
+		gs.ManaTemp = mana
 	}
 }
 
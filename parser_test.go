@@ -0,0 +1,275 @@
+package main
+
+import (
+	"testing"
+)
+
+func parseLines(gs *GameState, lines []string) {
+	for _, line := range lines {
+		ParseHearthstoneLogLine(line, gs)
+	}
+}
+
+func TestFullEntityBlock(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=42 CardID=EX1_066",
+		"[Power] GameState.DebugPrintPower() -     tag=HEALTH value=5",
+		"[Power] GameState.DebugPrintPower() -     tag=ATK value=4",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=PLAY",
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=43 CardID=",
+		"[Power] GameState.DebugPrintPower() -     tag=COST value=3",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=GameEntity tag=STEP value=MAIN_READY",
+		"[Power] GameState.DebugPrintPower() -     tag=HEALTH value=9",
+	})
+	ooze := gs.CardsById[42]
+	if ooze == nil || ooze.Name != "Acidic Swamp Ooze" || ooze.Attack != 4 || ooze.Health != 5 {
+		t.Error("Ooze not parsed:", ooze)
+	}
+	hidden := gs.CardsById[43]
+	if hidden == nil || hidden.JsonCardId != "" || hidden.Cost != 3 {
+		t.Error("Hidden card not parsed:", hidden)
+	}
+	if hidden != nil && hidden.Health != 0 {
+		t.Error("Tag line applied after the block ended.")
+	}
+}
+
+func TestShowAndChangeEntity(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=50 CardID=",
+		"[Power] GameState.DebugPrintPower() - SHOW_ENTITY - Updating Entity=[id=50 cardId= type=INVALID zone=HAND zonePos=1 player=2] CardID=EX1_604",
+		"[Power] GameState.DebugPrintPower() -     tag=ATK value=3",
+	})
+	card := gs.CardsById[50]
+	if card.JsonCardId != "EX1_604" || card.Name != "Frothing Berserker" || card.Attack != 3 || card.Health != 4 {
+		t.Error("SHOW_ENTITY not applied:", card)
+	}
+	gs.moveCard(card, "OPPOSING PLAY")
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - CHANGE_ENTITY - Updating Entity=[name=Frothing Berserker id=50 zone=PLAY zonePos=1 cardId=EX1_604 player=2] CardID=EX1_066",
+	})
+	if card.JsonCardId != "EX1_066" || card.Attack != 3 || card.Health != 2 || card.Zone != "OPPOSING PLAY" {
+		t.Error("CHANGE_ENTITY not applied:", card)
+	}
+	if _, ok := gs.CardsByZone["OPPOSING PLAY"][card]; !ok {
+		t.Error("Transformed card lost its zone.")
+	}
+}
+
+func TestIdentifyPlayers(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - CREATE_GAME",
+		"[Power] GameState.DebugPrintPower() -     GameEntity EntityID=1",
+		"[Power] GameState.DebugPrintPower() -         tag=10 value=85",
+		"[Power] GameState.DebugPrintPower() -     Player EntityID=2 PlayerID=1 GameAccountId=[hi=144115198130930503 lo=27472162]",
+		"[Power] GameState.DebugPrintPower() -         tag=CURRENT_PLAYER value=1",
+		"[Power] GameState.DebugPrintPower() -     Player EntityID=3 PlayerID=2 GameAccountId=[hi=144115198130930503 lo=11111111]",
+		"[Power] GameState.DebugPrintPower() -         tag=CURRENT_PLAYER value=0",
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=10 CardID=",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=HAND",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=1",
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=20 CardID=EX1_604",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=HAND",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=2",
+	})
+	if gs.LocalPlayerId != 2 {
+		t.Error("Wrong local player:", gs.LocalPlayerId)
+	}
+	if gs.CardsById[10].Zone != "OPPOSING HAND" || gs.CardsById[20].Zone != "FRIENDLY HAND" {
+		t.Error("Cards not sorted by controller:", gs.CardsById[10].Zone, gs.CardsById[20].Zone)
+	}
+
+	// The turn passes to PlayerID 2, which tells us their name.
+	_, _, playerIdentified := ParseHearthstoneLogLine(
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=DrTall tag=CURRENT_PLAYER value=1", &gs)
+	if playerIdentified || gs.Players[2].Name != "DrTall" {
+		t.Error("Player not named:", gs.Players[2])
+	}
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=DrTall tag=RESOURCES value=3",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=SomeoneElse tag=RESOURCES value=4",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Frothing Berserker id=20 zone=HAND zonePos=1 cardId=EX1_604 player=2] tag=ZONE value=PLAY",
+	})
+	if gs.ManaMax != 3 {
+		t.Error("Wrong mana:", gs.ManaMax)
+	}
+	if gs.Players[1].Name != "SomeoneElse" {
+		t.Error("Opponent not named by elimination:", gs.Players[1])
+	}
+	if gs.CardsById[20].Zone != "FRIENDLY PLAY" {
+		t.Error("ZONE tag change not applied:", gs.CardsById[20].Zone)
+	}
+}
+
+func TestTurnTracking(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - CREATE_GAME",
+		"[Power] GameState.DebugPrintPower() -     GameEntity EntityID=1",
+		"[Power] GameState.DebugPrintPower() -         tag=TURN value=1",
+		"[Power] GameState.DebugPrintPower() -         tag=STEP value=BEGIN_MULLIGAN",
+		"[Power] GameState.DebugPrintPower() -     Player EntityID=2 PlayerID=1 GameAccountId=[hi=1 lo=1]",
+		"[Power] GameState.DebugPrintPower() -         tag=CURRENT_PLAYER value=1",
+		"[Power] GameState.DebugPrintPower() -         tag=FIRST_PLAYER value=1",
+		"[Power] GameState.DebugPrintPower() -     Player EntityID=3 PlayerID=2 GameAccountId=[hi=1 lo=2]",
+		"[Power] GameState.DebugPrintPower() -         tag=CURRENT_PLAYER value=0",
+		"[Zone] ZoneChangeList.ProcessChanges() - TRANSITIONING card [name=Garrosh Hellscream id=4 zone=PLAY zonePos=0 cardId=HERO_01 player=1] to FRIENDLY PLAY (Hero)",
+	})
+	if gs.Turn != 1 || gs.FirstPlayerId != 1 || gs.CurrentPlayerId != 1 || gs.Step != "BEGIN_MULLIGAN" {
+		t.Error("Turn info not parsed:", gs.Turn, gs.FirstPlayerId, gs.CurrentPlayerId, gs.Step)
+	}
+	turnStart, _, _ := ParseHearthstoneLogLine("[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=GameEntity tag=STEP value=MAIN_ACTION", &gs)
+	if !turnStart || !gs.IsFriendlyMainPhase() {
+		t.Error("Friendly main phase not detected.")
+	}
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=GameEntity tag=STEP value=MAIN_END",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=Opponent tag=CURRENT_PLAYER value=1",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=Me tag=CURRENT_PLAYER value=0",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=GameEntity tag=TURN value=2",
+	})
+	turnStart, _, _ = ParseHearthstoneLogLine("[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=GameEntity tag=STEP value=MAIN_ACTION", &gs)
+	if !turnStart || gs.IsFriendlyMainPhase() || gs.CurrentPlayerId != 2 || gs.Turn != 2 {
+		t.Error("Opponent turn not detected:", gs.CurrentPlayerId, gs.Turn)
+	}
+	if gs.Players[1].Name != "Me" {
+		t.Error("Players misnamed:", gs.Players[1].Name)
+	}
+}
+
+func TestActionBlocks(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	gs.Turn = 3
+	berserker := gs.getOrCreateCard("EX1_604", 20)
+	berserker.Controller = 1
+	gs.getOrCreateCard("EX1_066", 30).Controller = 2
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - BLOCK_START BlockType=ATTACK Entity=[name=Frothing Berserker id=20 zone=PLAY zonePos=1 cardId=EX1_604 player=1] EffectCardId= EffectIndex=-1 Target=[name=Acidic Swamp Ooze id=30 zone=PLAY zonePos=1 cardId=EX1_066 player=2] SubOption=-1",
+		"[Power] GameState.DebugPrintPower() -     TAG_CHANGE Entity=[name=Acidic Swamp Ooze id=30 zone=PLAY zonePos=1 cardId=EX1_066 player=2] tag=DAMAGE value=2",
+		"[Power] GameState.DebugPrintPower() -     BLOCK_START BlockType=DEATHS Entity=GameEntity EffectCardId= EffectIndex=0 Target=0 SubOption=-1",
+		"[Power] GameState.DebugPrintPower() -         TAG_CHANGE Entity=[name=Acidic Swamp Ooze id=30 zone=PLAY zonePos=1 cardId=EX1_066 player=2] tag=ZONE value=GRAVEYARD",
+		"[Power] GameState.DebugPrintPower() -     BLOCK_END",
+		"[Power] GameState.DebugPrintPower() - BLOCK_END",
+		"[Power] GameState.DebugPrintPower() - ACTION_START Entity=[name=Acidic Swamp Ooze id=31 zone=HAND zonePos=1 cardId=EX1_066 player=1] BlockType=PLAY Index=0 Target=0",
+		"[Power] GameState.DebugPrintPower() - ACTION_END",
+	})
+	if len(gs.Actions) != 2 {
+		t.Fatal("Wrong number of top-level actions:", len(gs.Actions))
+	}
+	attack := gs.Actions[0]
+	if attack.Type != "ATTACK" || attack.SourceId != 20 || attack.TargetId != 30 || attack.Turn != 3 {
+		t.Error("Attack not parsed:", attack)
+	}
+	if len(attack.TagChanges) != 1 || attack.TagChanges[0].Tag != "DAMAGE" || attack.TagChanges[0].EntityId != 30 {
+		t.Error("Attack tag changes not recorded:", attack.TagChanges)
+	}
+	if len(attack.Children) != 1 || attack.Children[0].Type != "DEATHS" {
+		t.Fatal("Nested block not recorded.")
+	}
+	deaths := attack.Children[0]
+	if len(deaths.ZoneChanges) != 1 || deaths.ZoneChanges[0].InstanceId != 30 || deaths.ZoneChanges[0].To != "GRAVEYARD" {
+		t.Error("Zone change not recorded:", deaths.ZoneChanges)
+	}
+	if attacks := gs.Attacks(1, 3); len(attacks) != 1 || attacks[0] != attack {
+		t.Error("Attacks query failed:", attacks)
+	}
+	if len(gs.FindActions(3, "")) != 3 || len(gs.FindActions(4, "")) != 0 {
+		t.Error("FindActions query failed.")
+	}
+	if gs.Actions[1].Type != "PLAY" || gs.Actions[1].SourceId != 31 {
+		t.Error("Old-style ACTION_START not parsed:", gs.Actions[1])
+	}
+}
+
+func TestZonePositionTags(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	card := gs.getOrCreateCard("EX1_604", 20)
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Frothing Berserker id=20 zone=PLAY zonePos=1 cardId=EX1_604 player=1] tag=ZONE_POSITION value=3",
+	})
+	if card.ZonePosition != 3 {
+		t.Error("ZONE_POSITION not applied:", card.ZonePosition)
+	}
+	parseLines(&gs, []string{
+		"[Zone] ZoneChangeList.ProcessChanges() - id=5 local=False [name=Frothing Berserker id=20 zone=PLAY zonePos=3 cardId=EX1_604 player=1] pos from 3 -> 2",
+	})
+	if card.ZonePosition != 2 {
+		t.Error("[Zone] position change not applied:", card.ZonePosition)
+	}
+}
+
+func TestKeywordTags(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=60 CardID=EX1_008",
+		"[Power] GameState.DebugPrintPower() -     tag=DIVINE_SHIELD value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=WINDFURY value=1",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Argent Squire id=60 zone=PLAY zonePos=1 cardId=EX1_008 player=1] tag=DIVINE_SHIELD value=0",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Argent Squire id=60 zone=PLAY zonePos=1 cardId=EX1_008 player=1] tag=STEALTH value=1",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Argent Squire id=60 zone=PLAY zonePos=1 cardId=EX1_008 player=1] tag=POISONOUS value=1",
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Argent Squire id=60 zone=PLAY zonePos=1 cardId=EX1_008 player=1] tag=IMMUNE value=1",
+	})
+	card := gs.CardsById[60]
+	if card.DivineShield || !card.Windfury || !card.Stealth || !card.Poisonous || !card.Immune {
+		t.Error("Keyword tags not applied:", card)
+	}
+}
+
+func TestSpellTags(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=70 CardID=EX1_008",
+		"[Power] GameState.DebugPrintPower() -     tag=SPELLPOWER value=2",
+		"[Power] GameState.DebugPrintPower() -     tag=CANT_BE_TARGETED_BY_ABILITIES value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=CANT_BE_TARGETED_BY_HERO_POWERS value=1",
+	})
+	card := gs.CardsById[70]
+	if card.SpellPower != 2 || !card.CantBeTargetedBySpells || !card.CantBeTargetedByHeroPowers {
+		t.Error("Spell tags not applied:", card)
+	}
+}
+
+func TestHeroPowerTags(t *testing.T) {
+	gs := GameState{}
+	gs.resetGameState()
+	gs.setLocalPlayer(1)
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=65 CardID=CS2_034",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=CARDTYPE value=HERO_POWER",
+		"[Power] GameState.DebugPrintPower() -     tag=COST value=2",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=PLAY",
+		"[Power] GameState.DebugPrintPower() - FULL_ENTITY - Creating ID=66 CardID=CS2_034",
+		"[Power] GameState.DebugPrintPower() -     tag=CONTROLLER value=2",
+		"[Power] GameState.DebugPrintPower() -     tag=CARDTYPE value=HERO_POWER",
+		"[Power] GameState.DebugPrintPower() -     tag=EXHAUSTED value=1",
+		"[Power] GameState.DebugPrintPower() -     tag=ZONE value=PLAY",
+	})
+	heroPower := getSingletonFromZone(&gs, "FRIENDLY PLAY (Hero Power)", false)
+	if heroPower == nil || heroPower.InstanceId != 65 {
+		t.Fatal("Hero power not parsed:", heroPower)
+	}
+	if heroPower.Exhausted {
+		t.Error("Hero power should start out ready")
+	}
+	if !gs.CardsById[66].Exhausted {
+		t.Error("Expected EXHAUSTED=1 in the block to count")
+	}
+	parseLines(&gs, []string{
+		"[Power] GameState.DebugPrintPower() - TAG_CHANGE Entity=[name=Fireblast id=65 zone=PLAY zonePos=0 cardId=CS2_034 player=1] tag=EXHAUSTED value=1",
+	})
+	if !heroPower.Exhausted {
+		t.Error("Hero power should be used up")
+	}
+}
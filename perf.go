@@ -7,23 +7,21 @@ type PruningOpts struct {
 	isNodeHighPriority       func(node *DecisionTreeNode) bool
 	// Whether to optimize The Coin (you basically always should)
 	useCoinOptimization bool
+	// Whether to skip nodes identical to one already seen (see TranspositionTable)
+	useTranspositionTable bool
 }
 
-var GlobalPruningOpts PruningOpts
-
-func resetGlobalPruningOpts() {
-	GlobalPruningOpts = PruningOpts{
+// All the pruning we know how to do. See SolverOptions.
+func DefaultPruningOpts() PruningOpts {
+	return PruningOpts{
 		getCardsFromFriendlyZone: uniqueCardsInZone,
 		getCardsInOpposingPlay:   uniqueCardsInOpposingPlay,
 		isNodeHighPriority:       isFrothingBerserkerReady,
 		useCoinOptimization:      true,
+		useTranspositionTable:    true,
 	}
 }
 
-func init() {
-	resetGlobalPruningOpts()
-}
-
 // Returns a slices of "unique" *Cards, per CardInfo
 func uniqueCardsInZone(gs *GameState, zone string) []*Card {
 	result := make([]*Card, 0)
@@ -63,3 +61,21 @@ func isFrothingBerserkerReady(node *DecisionTreeNode) bool {
 	}
 	return false
 }
+
+// Roughly how much more damage the enemy hero needs to take once everything
+// of ours that can still attack goes face. Lower is more promising.
+func damageStillNeeded(gs *GameState) int32 {
+	enemyHero := getSingletonFromZone(gs, "OPPOSING PLAY (Hero)", false)
+	if enemyHero == nil {
+		return 0
+	}
+	needed := enemyHero.Health - enemyHero.Damage + enemyHero.Armor
+	for _, zone := range []string{"FRIENDLY PLAY", "FRIENDLY PLAY (Hero)"} {
+		for card := range gs.CardsByZone[zone] {
+			if canCardAttack(card) {
+				needed -= card.Attack
+			}
+		}
+	}
+	return needed
+}
@@ -0,0 +1,137 @@
+// Reviewing recorded games offline, without the client running.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// What the solver found at the start of one friendly turn of a replay.
+type ReplayTurn struct {
+	Game      int   // Which game in the log, starting from 1.
+	Turn      int32 // GameState.Turn, counting both players' turns.
+	Solutions []*DecisionTreeNode
+	Stats     SearchStats
+}
+
+// Reads a recorded Power.log (or output_log.txt) from start to finish. At the
+// start of each friendly main phase it runs `solver` to completion and hands
+// the result to onTurn, along with the live GameState at that point. When
+// each game ends, onGameEnd gets its missed-lethal report. deckList is our
+// decklist if we know it, or nil.
+func ReplayLog(r io.Reader, deckList []string, solver *Solver, onTurn func(gs *GameState, turn *ReplayTurn), onGameEnd func(report *GameReport)) error {
+	gs := GameState{}
+	gs.resetGameState()
+	gs.SetDeckList(deckList)
+	tracker := NewLethalTracker()
+	scanner := bufio.NewScanner(r)
+	// Some lines (e.g. long entity blocks in output_log.txt) are huge.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if report := tracker.BeforeLine(line, &gs); report != nil {
+			onGameEnd(report)
+		}
+		turnStart, _, _ := ParseHearthstoneLogLine(line, &gs)
+		if turnStart && gs.IsFriendlyMainPhase() {
+			solutions, stats := solver.SolveAll(context.Background(), gs.DeepCopy())
+			turn := &ReplayTurn{
+				Game:      tracker.Game,
+				Turn:      gs.Turn,
+				Solutions: solutions,
+				Stats:     stats,
+			}
+			for _, solution := range turn.Solutions {
+				tracker.AddSolution(turn.Turn, solution)
+			}
+			onTurn(&gs, turn)
+		}
+		if report := tracker.AfterLine(&gs); report != nil {
+			onGameEnd(report)
+		}
+	}
+	if report := tracker.Finish(&gs); report != nil {
+		onGameEnd(report)
+	}
+	return scanner.Err()
+}
+
+// `hearthstone-helper replay -log Power.log`
+func replayMain(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	hsLogFile := flags.String("log", "", "The file path to a recorded Hearthstone log file.")
+	hsUsername := flags.String("username", "", "Optional. Your battlenet ID (without the #1234), to help identify which player you are.")
+	budget := flags.Duration("budget", 10*time.Second, "How long to search for lethal on each turn.")
+	maxSolutions := flags.Int("max_solutions", 3, "How many distinct lethal lines to print per turn.")
+	saveStates := flags.String("save_states", "", "Optional. Save a GameState snapshot into this directory at the start of each of your turns.")
+	reportJson := flags.String("report_json", "", "Optional. Append each game's missed-lethal report to this file, one JSON object per line.")
+	deck := flags.String("deck", "", "Optional. Your decklist: a deck code, or a file with a deck code or one card per line.")
+	cards := addCardsFlag(flags)
+	effects := addEffectsFlag(flags)
+	flags.Parse(args)
+	if !loadCardDatabase(*cards) || !loadCardEffects(*effects) {
+		return 1
+	}
+
+	var deckList []string
+	if *deck != "" {
+		var err error
+		if deckList, err = LoadDeckList(*deck); err != nil {
+			fmt.Println("ERROR: Cannot load decklist:", err.Error())
+			return 1
+		}
+	}
+
+	logFile, err := os.Open(*hsLogFile)
+	if err != nil {
+		fmt.Println("ERROR: Cannot open log file:", err.Error())
+		return 1
+	}
+	defer logFile.Close()
+	SetLocalUsername(*hsUsername)
+	var reportFile *os.File
+	if *reportJson != "" {
+		if reportFile, err = os.OpenFile(*reportJson, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			fmt.Println("ERROR: Cannot open report file:", err.Error())
+			return 1
+		}
+		defer reportFile.Close()
+	}
+
+	solver := NewSolver(SolverOptions{Deadline: *budget})
+	err = ReplayLog(logFile, deckList, solver, func(gs *GameState, turn *ReplayTurn) {
+		if *saveStates != "" {
+			saveTurnSnapshot(*saveStates, turn.Game, gs)
+		}
+		if len(turn.Solutions) == 0 {
+			fmt.Printf("INFO: Game %v turn %v: %v\n", turn.Game, turn.Turn, describeNoLethal(turn.Stats))
+			return
+		}
+		fmt.Printf("INFO: Game %v turn %v: lethal! %v distinct lines found.\n", turn.Game, turn.Turn, len(turn.Solutions))
+		for i, solution := range turn.Solutions {
+			if i >= *maxSolutions {
+				break
+			}
+			fmt.Printf("Line %v:\n", i+1)
+			prettyPrintDecisionTreeNode(solution)
+		}
+	}, func(report *GameReport) {
+		prettyPrintGameReport(report)
+		if reportFile != nil {
+			if err := writeGameReportJson(reportFile, report); err != nil {
+				fmt.Println("ERROR: Cannot write report:", err.Error())
+			}
+		}
+	})
+	if err != nil {
+		fmt.Println("ERROR: Cannot read log file:", err.Error())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReplayLog(t *testing.T) {
+	logFile, err := os.Open("testdata/lethal.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	turns := make([]*ReplayTurn, 0)
+	reports := make([]*GameReport, 0)
+	err = ReplayLog(logFile, nil, NewSolver(SolverOptions{Deadline: 200 * time.Millisecond}), func(gs *GameState, turn *ReplayTurn) {
+		turns = append(turns, turn)
+	}, func(report *GameReport) {
+		reports = append(reports, report)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Turn 2 is the opponent's, so only turns 1 and 3 are solved.
+	if len(turns) != 2 || turns[0].Turn != 1 || turns[1].Turn != 3 {
+		t.Fatal("Wrong turns solved:", turns)
+	}
+	if len(turns[0].Solutions) != 0 {
+		t.Error("Found lethal on turn 1:", turns[0].Solutions)
+	}
+	if len(turns[1].Solutions) == 0 || turns[1].Game != 1 {
+		t.Error("Missed lethal on turn 3.")
+	}
+
+	// The log ends without a result, so the turn 3 lethal counts as missed.
+	if len(reports) != 1 || reports[0].Result != "UNFINISHED" || len(reports[0].MissedLethals) != 1 {
+		t.Fatal("Wrong reports:", reports)
+	}
+	missed := reports[0].MissedLethals[0]
+	if missed.Turn != 3 || len(missed.ActualMoves) != 1 || missed.ActualMoves[0] != "Frothing Berserker attacks Thrall" {
+		t.Error("Wrong missed lethal:", missed)
+	}
+}
+
+func TestLethalTrackerWonGame(t *testing.T) {
+	gs := createEmptyGameState()
+	tracker := NewLethalTracker()
+	tracker.BeforeLine("[Power] GameState.DebugPrintPower() - CREATE_GAME", &gs)
+	gs.LocalPlayerId = 1
+	gs.Players[1] = &Player{PlayerId: 1, PlayState: "WON"}
+	gs.Turn = 5
+	solution := &DecisionTreeNode{Moves: []*MoveParams{&MoveParams{Description: "Win"}}, SuccessProbability: 1}
+	tracker.AddSolution(3, solution)
+	tracker.AddSolution(5, solution)
+	tracker.AddSolution(5, solution)
+	if report := tracker.AfterLine(&gs); report != nil {
+		t.Error("Reported a game that isn't over.")
+	}
+	gs.Winner = FRIENDLY_VICTORY
+	report := tracker.AfterLine(&gs)
+	if report == nil || report.Game != 1 || report.Result != "WON" {
+		t.Fatal("Wrong report:", report)
+	}
+	// Turn 5 is when we won, so only turn 3 was missed.
+	if len(report.MissedLethals) != 1 || report.MissedLethals[0].Turn != 3 {
+		t.Error("Wrong missed lethals:", report.MissedLethals)
+	}
+	if tracker.AfterLine(&gs) != nil || tracker.Finish(&gs) != nil {
+		t.Error("Reported the same game twice.")
+	}
+}
@@ -0,0 +1,139 @@
+// Post-game reports of the lethal the player missed.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A friendly turn where the solver found lethal but the game went on.
+type MissedLethal struct {
+	Turn        int32      `json:"turn"`
+	Solutions   [][]string `json:"solutions"`   // Move descriptions, fewest moves first.
+	ActualMoves []string   `json:"actualMoves"` // What the player did instead.
+}
+
+type GameReport struct {
+	Game          int            `json:"game"`
+	Result        string         `json:"result"` // The local player's PLAYSTATE, or "UNFINISHED".
+	FinalTurn     int32          `json:"finalTurn"`
+	MissedLethals []MissedLethal `json:"missedLethals"`
+}
+
+// Keeps the lethal lines found during each game, and reports the ones that
+// were missed once the game is over (it has a winner, the next CREATE_GAME
+// arrives, or the log runs out).
+type LethalTracker struct {
+	Game      int // Which game in the log, starting from 1. 0 before the first.
+	solutions map[int32][]*DecisionTreeNode
+	reported  bool
+}
+
+func NewLethalTracker() *LethalTracker {
+	return &LethalTracker{
+		solutions: make(map[int32][]*DecisionTreeNode),
+		reported:  true,
+	}
+}
+
+// Records a lethal line the solver found on the given turn. Lines that
+// needed a lucky draw don't count as missed.
+func (t *LethalTracker) AddSolution(turn int32, solution *DecisionTreeNode) {
+	if solution.SuccessProbability < 1 {
+		return
+	}
+	key := getSolutionKey(solution)
+	for _, existing := range t.solutions[turn] {
+		if getSolutionKey(existing) == key {
+			return
+		}
+	}
+	t.solutions[turn] = append(t.solutions[turn], solution)
+}
+
+// Must be called with every log line before it is parsed. If the line starts
+// a new game, returns the report for the previous one, if there is one.
+func (t *LethalTracker) BeforeLine(line string, gs *GameState) *GameReport {
+	if !newGamePattern.MatchString(line) {
+		return nil
+	}
+	report := t.Finish(gs)
+	t.Game += 1
+	t.solutions = make(map[int32][]*DecisionTreeNode)
+	t.reported = false
+	return report
+}
+
+// Must be called after every log line is parsed. Returns the report if the
+// game just ended.
+func (t *LethalTracker) AfterLine(gs *GameState) *GameReport {
+	if gs.Winner == NO_VICTORY {
+		return nil
+	}
+	return t.Finish(gs)
+}
+
+// Reports the current game if it hasn't been already, e.g. at the end of the log.
+func (t *LethalTracker) Finish(gs *GameState) *GameReport {
+	if t.reported {
+		return nil
+	}
+	t.reported = true
+	report := &GameReport{
+		Game:          t.Game,
+		Result:        "UNFINISHED",
+		FinalTurn:     gs.Turn,
+		MissedLethals: make([]MissedLethal, 0),
+	}
+	if player, ok := gs.Players[gs.LocalPlayerId]; ok && gs.Winner != NO_VICTORY {
+		report.Result = player.PlayState
+	}
+	for turn := int32(1); turn <= gs.Turn; turn++ {
+		solutions := t.solutions[turn]
+		if len(solutions) == 0 || (gs.Winner == FRIENDLY_VICTORY && turn == gs.Turn) {
+			continue
+		}
+		missed := MissedLethal{
+			Turn:        turn,
+			Solutions:   make([][]string, len(solutions)),
+			ActualMoves: gs.DescribeMoves(gs.LocalPlayerId, turn),
+		}
+		for i, solution := range solutions {
+			missed.Solutions[i] = strings.Split(getSolutionKey(solution), "\n")
+		}
+		report.MissedLethals = append(report.MissedLethals, missed)
+	}
+	return report
+}
+
+func prettyPrintGameReport(report *GameReport) {
+	fmt.Printf("INFO: Game %v is over (%v on turn %v). Missed lethal on %v turns.\n",
+		report.Game, report.Result, report.FinalTurn, len(report.MissedLethals))
+	for _, missed := range report.MissedLethals {
+		fmt.Printf("Turn %v, lethal was:\n", missed.Turn)
+		for i, move := range missed.Solutions[0] {
+			fmt.Printf("%v.  %v\n", i+1, move)
+		}
+		fmt.Println("but you did:")
+		if len(missed.ActualMoves) == 0 {
+			fmt.Println("    nothing")
+		}
+		for _, move := range missed.ActualMoves {
+			fmt.Printf("    %v\n", move)
+		}
+	}
+}
+
+// Writes the report as a single line of JSON, so that reports from many
+// sessions can be appended to one file and aggregated later.
+func writeGameReportJson(w io.Writer, report *GameReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
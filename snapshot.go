@@ -0,0 +1,183 @@
+// Saving and loading GameStates, e.g. to attach an interesting position to a
+// bug report instead of a whole log.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Bump this whenever gameStateSnapshot (or the json tags on Card or Player)
+// change in a way older readers can't handle.
+const GameStateSnapshotVersion = 1
+
+// The on-disk form of a GameState. CardsByZone is rebuilt from each card's
+// Zone on load, and the action history and parser bookkeeping are not saved.
+type gameStateSnapshot struct {
+	Version          int              `json:"version"`
+	Cards            []*Card          `json:"cards"` // Sorted by InstanceId.
+	Players          []*Player        `json:"players"`
+	LocalPlayerId    int32            `json:"localPlayerId"`
+	ManaMax          int32            `json:"manaMax"`
+	ManaUsed         int32            `json:"manaUsed"`
+	ManaTemp         int32            `json:"manaTemp"`
+	HighestCardId    int32            `json:"highestCardId"`
+	HighestPlayOrder int32            `json:"highestPlayOrder"`
+	Winner           int32            `json:"winner"` // NO_VICTORY, FRIENDLY_VICTORY or OPPOSING_VICTORY_OR_DRAW.
+	Turn             int32            `json:"turn"`
+	CurrentPlayerId  int32            `json:"currentPlayerId"`
+	FirstPlayerId    int32            `json:"firstPlayerId"`
+	Step             string           `json:"step"`
+	NextStep         string           `json:"nextStep"`
+	DeckList         []string         `json:"deckList,omitempty"`
+	RemainingDeck    map[string]int32 `json:"remainingDeck,omitempty"` // Left out if we don't know our deck.
+}
+
+// Lets prettyPrint and json.Marshal work on a whole GameState.
+func (gs *GameState) MarshalJSON() ([]byte, error) {
+	snapshot := gameStateSnapshot{
+		Version:          GameStateSnapshotVersion,
+		Cards:            make([]*Card, 0, len(gs.CardsById)),
+		Players:          make([]*Player, 0, len(gs.Players)),
+		LocalPlayerId:    gs.LocalPlayerId,
+		ManaMax:          gs.ManaMax,
+		ManaUsed:         gs.ManaUsed,
+		ManaTemp:         gs.ManaTemp,
+		HighestCardId:    gs.HighestCardId,
+		HighestPlayOrder: gs.HighestPlayOrder,
+		Winner:           gs.Winner,
+		Turn:             gs.Turn,
+		CurrentPlayerId:  gs.CurrentPlayerId,
+		FirstPlayerId:    gs.FirstPlayerId,
+		Step:             gs.Step,
+		NextStep:         gs.NextStep,
+		DeckList:         gs.DeckList,
+		RemainingDeck:    gs.RemainingDeck,
+	}
+	for _, card := range gs.CardsById {
+		snapshot.Cards = append(snapshot.Cards, card)
+	}
+	sort.Slice(snapshot.Cards, func(i, j int) bool {
+		return snapshot.Cards[i].InstanceId < snapshot.Cards[j].InstanceId
+	})
+	for _, player := range gs.Players {
+		snapshot.Players = append(snapshot.Players, player)
+	}
+	sort.Slice(snapshot.Players, func(i, j int) bool {
+		return snapshot.Players[i].PlayerId < snapshot.Players[j].PlayerId
+	})
+	return json.Marshal(&snapshot)
+}
+
+func (gs *GameState) UnmarshalJSON(data []byte) error {
+	var snapshot gameStateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	if snapshot.Version < 1 || snapshot.Version > GameStateSnapshotVersion {
+		return fmt.Errorf("unsupported GameState snapshot version %v (this build reads up to %v)",
+			snapshot.Version, GameStateSnapshotVersion)
+	}
+	gs.resetGameState()
+	for _, card := range snapshot.Cards {
+		if card == nil {
+			return fmt.Errorf("null card in snapshot")
+		}
+		if _, exists := gs.CardsById[card.InstanceId]; exists {
+			return fmt.Errorf("duplicate card InstanceId %v in snapshot", card.InstanceId)
+		}
+		gs.CardsById[card.InstanceId] = card
+		zone := card.Zone
+		card.Zone = ""
+		gs.rezoneCard(card, zone) // Populate CardsByZone
+	}
+	for _, player := range snapshot.Players {
+		if player == nil {
+			return fmt.Errorf("null player in snapshot")
+		}
+		if _, exists := gs.Players[player.PlayerId]; exists {
+			return fmt.Errorf("duplicate PlayerId %v in snapshot", player.PlayerId)
+		}
+		gs.Players[player.PlayerId] = player
+	}
+	gs.LocalPlayerId = snapshot.LocalPlayerId
+	gs.ManaMax = snapshot.ManaMax
+	gs.ManaUsed = snapshot.ManaUsed
+	gs.ManaTemp = snapshot.ManaTemp
+	gs.HighestCardId = snapshot.HighestCardId
+	gs.HighestPlayOrder = snapshot.HighestPlayOrder
+	// Hand-written states may leave these out, and new cards mustn't reuse ids.
+	for _, card := range gs.CardsById {
+		if card.InstanceId > gs.HighestCardId {
+			gs.HighestCardId = card.InstanceId
+		}
+		if card.PlayOrder > gs.HighestPlayOrder {
+			gs.HighestPlayOrder = card.PlayOrder
+		}
+	}
+	gs.Winner = snapshot.Winner
+	gs.Turn = snapshot.Turn
+	gs.CurrentPlayerId = snapshot.CurrentPlayerId
+	gs.FirstPlayerId = snapshot.FirstPlayerId
+	gs.Step = snapshot.Step
+	gs.NextStep = snapshot.NextStep
+	gs.DeckList = snapshot.DeckList
+	gs.RemainingDeck = snapshot.RemainingDeck
+	return nil
+}
+
+// Writes the GameState as an indented, versioned JSON document.
+func (gs *GameState) Save(w io.Writer) error {
+	data, err := json.MarshalIndent(gs, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Reads a GameState written by Save.
+func LoadGameState(r io.Reader) (*GameState, error) {
+	gs := &GameState{}
+	if err := json.NewDecoder(r).Decode(gs); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+func SaveGameStateFile(gs *GameState, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gs.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func LoadGameStateFile(path string) (*GameState, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadGameState(file)
+}
+
+// Saves the state under dir as e.g. "game2-turn7.json". Errors are only
+// printed, since a missing snapshot shouldn't interrupt the game.
+func saveTurnSnapshot(dir string, game int, gs *GameState) {
+	path := filepath.Join(dir, fmt.Sprintf("game%v-turn%v.json", game, gs.Turn))
+	if err := SaveGameStateFile(gs, path); err != nil {
+		fmt.Println("ERROR: Cannot save GameState snapshot:", err.Error())
+		return
+	}
+	fmt.Println("INFO: Saved GameState snapshot to", path)
+}
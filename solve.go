@@ -0,0 +1,66 @@
+// Running the solver on a saved GameState, for reproducing solver behaviour
+// and for scripting puzzle positions.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// Exit codes for `solve`.
+const (
+	SOLVE_EXIT_LETHAL    = 0
+	SOLVE_EXIT_NO_LETHAL = 1
+	SOLVE_EXIT_ERROR     = 2
+)
+
+// `hearthstone-helper solve -state game1-turn7.json`
+func solveMain(args []string) int {
+	flags := flag.NewFlagSet("solve", flag.ExitOnError)
+	statePath := flags.String("state", "", "The file path to a GameState snapshot.")
+	deadline := flags.Duration("deadline", 60*time.Second, "Give up searching after this long.")
+	maxNodes := flags.Int("max_nodes", 0, "Optional. Give up searching after this many nodes.")
+	workers := flags.Int("workers", 0, "Optional. How many nodes to expand at once. Defaults to the number of CPUs.")
+	maxMemoryMb := flags.Uint64("max_memory_mb", DEFAULT_MAX_MEMORY>>20, "Give up searching once the whole process uses this much memory. 0 for no limit.")
+	verbose := flags.Bool("verbose", false, "Print the search's progress, and the deepest line if there's no lethal.")
+	cards := addCardsFlag(flags)
+	effects := addEffectsFlag(flags)
+	flags.Parse(args)
+	if !loadCardDatabase(*cards) || !loadCardEffects(*effects) {
+		return SOLVE_EXIT_ERROR
+	}
+
+	gs, err := LoadGameStateFile(*statePath)
+	if err != nil {
+		fmt.Println("ERROR: Cannot load GameState snapshot:", err.Error())
+		return SOLVE_EXIT_ERROR
+	}
+	solutions, stats := NewSolver(SolverOptions{
+		Deadline:  *deadline,
+		MaxNodes:  *maxNodes,
+		Workers:   *workers,
+		MaxMemory: maxMemoryFromMb(*maxMemoryMb),
+		Verbose:   *verbose,
+	}).SolveAll(context.Background(), gs)
+	for i, solution := range solutions {
+		fmt.Printf("Solution %v:\n", i+1)
+		prettyPrintDecisionTreeNode(solution)
+	}
+	fmt.Printf("INFO: %v distinct solutions (%v total) after exploring %v nodes to depth %v in %v (stopped: %v).\n",
+		len(solutions), stats.Solutions, stats.NodesExplored, stats.MaxDepth, stats.Elapsed, stats.StoppedBy)
+	fmt.Printf("INFO: %v nodes (%.0f%%) were transpositions of ones already seen.\n", stats.Transpositions, stats.TranspositionHitRate()*100)
+	if len(solutions) == 0 {
+		fmt.Println("INFO:", describeNoLethal(stats))
+	}
+	if stats.NodesDropped > 0 {
+		fmt.Printf("WARN: %v nodes were left unexplored because the search frontier was full.\n", stats.NodesDropped)
+	}
+	if len(solutions) == 0 || solutions[0].SuccessProbability < 1 {
+		// Lines that need a lucky draw are printed, but aren't lethal.
+		return SOLVE_EXIT_NO_LETHAL
+	}
+	return SOLVE_EXIT_LETHAL
+}
@@ -15,16 +15,28 @@ var _ = fmt.Printf
 // ALWAYS played without a target. It is up to the caller to note that
 // minions requiring targets can be played without a target when none exists.
 func getPlayCardTargetFilter(card *Card) func(*Card) bool {
-	if filter, ok := specialCardTargetFilters[card.JsonCardId]; ok {
-		return filter
+	filter, ok := specialCardTargetFilters[card.JsonCardId]
+	if !ok {
+		filter = func(target *Card) bool { return true }
 	}
-	// Do we even know how to play this spell?
-	if card.Type == "Spell" {
+	if card.Type == "Spell" || card.Type == "Hero Power" {
+		// Do we even know how to play this spell (or hero power)?
 		if _, ok := GlobalCardPlayedActions[card.JsonCardId]; !ok {
 			return func(target *Card) bool { return false }
 		}
+		return func(target *Card) bool {
+			if target != nil && !target.Silenced {
+				if card.Type == "Spell" && target.CantBeTargetedBySpells {
+					return false
+				}
+				if card.Type == "Hero Power" && target.CantBeTargetedByHeroPowers {
+					return false
+				}
+			}
+			return filter(target)
+		}
 	}
-	return func(target *Card) bool { return true }
+	return filter
 }
 
 var specialCardTargetFilters = map[string]func(*Card) bool{
@@ -32,6 +44,32 @@ var specialCardTargetFilters = map[string]func(*Card) bool{
 	"CS2_108": func(card *Card) bool { return targetEnemyMinion(card) && card.Damage > 0 }, // Execute
 	"EX1_607": targetAnyMinion,                                                             // Inner Rage
 	"EX1_391": targetAnyMinion,                                                             // Slam
+	"EX1_275": targetAnyMinion,                                                             // Cone of Cold
+	"EX1_126": targetEnemyMinion,                                                           // Betrayal
+	"CS2_029": targetAnyCharacter,                                                          // Fireball
+	"CS2_024": targetAnyCharacter,                                                          // Frostbolt
+	"CS2_008": targetAnyCharacter,                                                          // Moonfire
+	"DS1_185": targetAnyCharacter,                                                          // Arcane Shot
+	"CS1_130": targetAnyCharacter,                                                          // Holy Smite
+	"EX1_173": targetAnyCharacter,                                                          // Starfire
+	"EX1_238": targetAnyCharacter,                                                          // Lightning Bolt
+	"EX1_241": targetAnyCharacter,                                                          // Lava Burst
+	"CS2_031": targetAnyCharacter,                                                          // Ice Lance
+	"CS2_012": targetEnemyCharacter,                                                        // Swipe
+	"DS1_233": func(card *Card) bool { return card == nil },                                // Mind Blast
+
+	// Hero powers, including the Hero Skins' copies (_H1) and the upgrades
+	// from Justicar Trueheart (AT_132_*).
+	"CS2_034":       targetAnyCharacter,                           // Fireblast
+	"CS2_034_H1":    targetAnyCharacter,                           // Fireblast
+	"AT_132_MAGE":   targetAnyCharacter,                           // Fireblast Rank 2
+	"CS1h_001":      targetAnyCharacter,                           // Lesser Heal
+	"AT_132_PRIEST": targetAnyCharacter,                           // Heal
+	"EX1_625t":      targetAnyCharacter,                           // Mind Spike
+	"EX1_625t2":     targetAnyCharacter,                           // Mind Shatter
+	"DS1h_292":      func(card *Card) bool { return card == nil }, // Steady Shot
+	"DS1h_292_H1":   func(card *Card) bool { return card == nil }, // Steady Shot
+	"AT_132_HUNTER": func(card *Card) bool { return card == nil }, // Ballista Shot
 }
 
 func targetEnemyMinion(card *Card) bool {
@@ -42,48 +80,270 @@ func targetAnyMinion(card *Card) bool {
 	return card != nil && card.Type == "Minion" && strings.Contains(card.Zone, "PLAY")
 }
 
+func targetAnyCharacter(card *Card) bool {
+	return targetAnyMinion(card) || (card != nil && strings.HasSuffix(card.Zone, "PLAY (Hero)"))
+}
+
+func targetEnemyCharacter(card *Card) bool {
+	return targetAnyCharacter(card) && getSide(card.Zone) == "OPPOSING"
+}
+
 ////////////////////
 
 // All functions that we care about/ know about for when a card (key of the map is JsonId)
 // is played with optional target `targetCardId`  The action should modify `gs`
 // It is up to the caller to call gs.cleanupState afterwards.
 var GlobalCardPlayedActions = map[string]func(gs *GameState, params *MoveParams){
-	// "EX1_392": // Battle Rage -- TODO how do we handle card draw?
+	"EX1_392": func(gs *GameState, params *MoveParams) { // Battle Rage
+		var numDamaged int32
+		for _, zone := range []string{"FRIENDLY PLAY", "FRIENDLY PLAY (Hero)"} {
+			for character := range gs.CardsByZone[zone] {
+				if character.Damage > 0 {
+					numDamaged += 1
+				}
+			}
+		}
+		gs.drawCards(numDamaged)
+	},
 	"EX1_603": taskmasterAction,                                                                 // Cruel Taskmaster
 	"CS2_108": func(gs *GameState, params *MoveParams) { params.CardTwo.PendingDestroy = true }, // Execute
-	// "CS2_147": // Gnomish Inventor -- TODO how do we handle card draw?
-	"EX1_607": taskmasterAction,                                                             // Inner Rage
-	"EX1_391": func(gs *GameState, params *MoveParams) { gs.dealDamage(params.CardTwo, 2) }, // Slam -- TODO how do we handle card draw?
+	"CS2_147": drawCardsAction(1),                                                               // Gnomish Inventor
+	"EX1_015": drawCardsAction(1),                                                               // Novice Engineer
+	"EX1_284": drawCardsAction(1),                                                               // Azure Drake
+	"CS2_023": drawCardsAction(2),                                                               // Arcane Intellect
+	"EX1_606": func(gs *GameState, params *MoveParams) { // Shield Block
+		getSingletonFromZone(gs, "FRIENDLY PLAY (Hero)", true).Armor += 5
+		gs.drawCards(1)
+	},
+	"EX1_607": taskmasterAction, // Inner Rage
+	"EX1_391": func(gs *GameState, params *MoveParams) { // Slam
+		gs.dealDamage(params.CardTwo, gs.getSpellDamage(params.CardOne, 2))
+		if !minionNeedsKilling(params.CardTwo) {
+			gs.drawCards(1)
+		}
+	},
+	"CS2_029": damageTargetAction(6), // Fireball
+	"CS2_024": func(gs *GameState, params *MoveParams) { // Frostbolt
+		params.CardTwo.Frozen = true
+		gs.dealDamage(params.CardTwo, gs.getSpellDamage(params.CardOne, 3))
+	},
+	"CS2_008": damageTargetAction(1), // Moonfire
+	"DS1_185": damageTargetAction(2), // Arcane Shot
+	"CS1_130": damageTargetAction(2), // Holy Smite
+	"EX1_173": func(gs *GameState, params *MoveParams) { // Starfire
+		gs.dealDamage(params.CardTwo, gs.getSpellDamage(params.CardOne, 5))
+		gs.drawCards(1)
+	},
+	"EX1_238": damageTargetAction(3), // Lightning Bolt (the Overload only matters next turn)
+	"EX1_241": damageTargetAction(5), // Lava Burst
+	"CS2_031": func(gs *GameState, params *MoveParams) { // Ice Lance
+		if params.CardTwo.Frozen {
+			gs.dealDamage(params.CardTwo, gs.getSpellDamage(params.CardOne, 4))
+		} else {
+			params.CardTwo.Frozen = true
+		}
+	},
+	"CS2_012": func(gs *GameState, params *MoveParams) { // Swipe
+		others := []*Card{getSingletonFromZone(gs, "OPPOSING PLAY (Hero)", true)}
+		others = append(others, gs.getOrderedZone("OPPOSING PLAY")...)
+		gs.dealDamage(params.CardTwo, gs.getSpellDamage(params.CardOne, 4))
+		for _, other := range others {
+			if other != params.CardTwo {
+				gs.dealDamage(other, gs.getSpellDamage(params.CardOne, 1))
+			}
+		}
+	},
+	"DS1_233": func(gs *GameState, params *MoveParams) { // Mind Blast
+		gs.dealDamage(getSingletonFromZone(gs, "OPPOSING PLAY (Hero)", true), gs.getSpellDamage(params.CardOne, 5))
+	},
 	"GAME_005": func(gs *GameState, params *MoveParams) {
 		if gs.ManaMax < 10 || gs.ManaUsed > 0 {
 			gs.ManaTemp += 1
 		}
 	}, // The Coin
 	"EX1_400": whirlwindAction, // Whirlwind
+	"EX1_093": func(gs *GameState, params *MoveParams) { // Defender of Argus
+		for _, neighbor := range gs.getAdjacentMinions(params.CardOne) {
+			neighbor.Attack += 1
+			neighbor.Health += 1
+			neighbor.Taunt = true
+		}
+	},
+	"EX1_275": func(gs *GameState, params *MoveParams) { // Cone of Cold
+		victims := append([]*Card{params.CardTwo}, gs.getAdjacentMinions(params.CardTwo)...)
+		for _, victim := range victims {
+			victim.Frozen = true
+			gs.dealDamage(victim, gs.getSpellDamage(params.CardOne, 1))
+		}
+	},
+	"EX1_126": func(gs *GameState, params *MoveParams) { // Betrayal
+		for _, neighbor := range gs.getAdjacentMinions(params.CardTwo) {
+			gs.dealDamage(neighbor, params.CardTwo.Attack)
+		}
+	},
+
+	// Hero powers. See specialCardTargetFilters for the ids.
+	"CS2_034":        damageTargetAction(1),                                       // Fireblast
+	"CS2_034_H1":     damageTargetAction(1),                                       // Fireblast
+	"AT_132_MAGE":    damageTargetAction(2),                                       // Fireblast Rank 2
+	"EX1_625t":       damageTargetAction(2),                                       // Mind Spike
+	"EX1_625t2":      damageTargetAction(3),                                       // Mind Shatter
+	"DS1h_292":       damageEnemyHeroAction(2),                                    // Steady Shot
+	"DS1h_292_H1":    damageEnemyHeroAction(2),                                    // Steady Shot
+	"AT_132_HUNTER":  damageEnemyHeroAction(3),                                    // Ballista Shot
+	"CS2_102":        gainArmorAction(2),                                          // Armor Up!
+	"CS2_102_H1":     gainArmorAction(2),                                          // Armor Up!
+	"AT_132_WARRIOR": gainArmorAction(4),                                          // Tank Up!
+	"CS2_017":        shapeshiftAction(1),                                         // Shapeshift
+	"AT_132_DRUID":   shapeshiftAction(2),                                         // Dire Shapeshift
+	"CS2_056":        lifeTapAction(2),                                            // Life Tap
+	"AT_132_WARLOCK": lifeTapAction(0),                                            // Soul Tap
+	"CS1h_001":       healTargetAction(2),                                         // Lesser Heal
+	"AT_132_PRIEST":  healTargetAction(4),                                         // Heal
+	"CS2_101":        summonMinionsAction("CS2_101t", 1),                          // Reinforce
+	"CS2_101_H1":     summonMinionsAction("CS2_101t", 1),                          // Reinforce
+	"AT_132_PALADIN": summonMinionsAction("CS2_101t", 2),                          // The Silver Hand
+	"EX1_tk33":       summonMinionsAction("EX1_tk34", 1),                          // INFERNO!
+	"CS2_083b":       equipWeaponAction("CS2_082", "Wicked Knife", 1, 2),          // Dagger Mastery
+	"AT_132_ROGUE":   equipWeaponAction("AT_132_ROGUEt", "Poisoned Dagger", 2, 2), // Poisoned Daggers
+	// Totemic Slam lets us choose; Wrath of Air is the only totem that can
+	// make a difference this turn. Totemic Call (CS2_049) picks at random,
+	// and none of its totems can be relied on for damage, so we never use it.
+	"AT_132_SHAMAN": summonMinionsAction("CS2_052", 1), // Totemic Slam
+}
+
+// Steady Shot and friends, which always hit the enemy hero.
+func damageEnemyHeroAction(amount int32) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		if hero := getSingletonFromZone(gs, getOtherSide(params.CardOne.Zone)+" PLAY (Hero)", true); hero != nil {
+			gs.dealDamage(hero, amount)
+		}
+	}
+}
+
+func gainArmorAction(amount int32) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		if hero := getSingletonFromZone(gs, getSide(params.CardOne.Zone)+" PLAY (Hero)", true); hero != nil {
+			hero.Armor += amount
+		}
+	}
+}
+
+// The Attack only lasts this turn, which is all the solver looks at anyway.
+func shapeshiftAction(amount int32) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		if hero := getSingletonFromZone(gs, getSide(params.CardOne.Zone)+" PLAY (Hero)", true); hero != nil {
+			hero.Attack += amount
+			hero.Armor += amount
+		}
+	}
+}
+
+func lifeTapAction(damage int32) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		gs.drawCards(1)
+		if hero := getSingletonFromZone(gs, getSide(params.CardOne.Zone)+" PLAY (Hero)", true); hero != nil && damage > 0 {
+			gs.dealDamage(hero, damage)
+		}
+	}
+}
+
+func healTargetAction(amount int32) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		gs.restoreHealth(params.CardTwo, amount)
+	}
+}
+
+// Summons up to `n` copies of a minion on the right of our board.
+func summonMinionsAction(jsonId string, n int) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		gs.summonMinions(jsonId, getSide(params.CardOne.Zone)+" PLAY", n)
+	}
+}
+
+// Equips a new weapon. The name and stats are given because older card data
+// (e.g. AllSets.json) doesn't have the upgraded hero powers' weapons.
+func equipWeaponAction(jsonId string, name string, attack int32, durability int32) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		var weapon *Card
+		if _, ok := GlobalCardJsonData[jsonId]; ok {
+			weapon = gs.getOrCreateCard(jsonId, gs.HighestCardId+1)
+		} else {
+			weapon = gs.getOrCreateCard("", gs.HighestCardId+1)
+			weapon.JsonCardId = jsonId
+		}
+		weapon.Type = "Weapon"
+		weapon.Name = name
+		weapon.Attack = attack
+		weapon.Durability = durability
+		weapon.Exhausted = false
+		gs.equipWeapon(weapon)
+	}
 }
 
 func taskmasterAction(gs *GameState, params *MoveParams) {
 	//fmt.Println("DEBUG: taskmasterAction with target: ", params.CardTwo)
 	if params.CardTwo != nil {
 		params.CardTwo.Attack += 2
-		gs.dealDamage(params.CardTwo, 1)
+		gs.dealDamage(params.CardTwo, gs.getSpellDamage(params.CardOne, 1))
 	}
 }
 
-func whirlwindAction(gs *GameState, _ *MoveParams) {
+// For the Whirlwind spell as well as deathrattles like Unstable Ghoul's;
+// only the spell gets Spell Damage.
+func whirlwindAction(gs *GameState, params *MoveParams) {
+	amount := int32(1)
+	if params != nil {
+		amount = gs.getSpellDamage(params.CardOne, amount)
+	}
 	//total := 0
 	for minion := range gs.CardsByZone["FRIENDLY PLAY"] {
 		//total += 1
 		//fmt.Printf("DEBUG: whirlwindAction sees %v friends\n", len(gs.CardsByZone["FRIENDLY PLAY"]))
-		gs.dealDamage(minion, 1)
+		gs.dealDamage(minion, amount)
 	}
 	for minion := range gs.CardsByZone["OPPOSING PLAY"] {
 		//total += 1
-		gs.dealDamage(minion, 1)
+		gs.dealDamage(minion, amount)
 	}
 	//fmt.Printf("DEBUG: whirlwindAction just did %v damage\n", total)
 }
 
+// An action drawing `n` cards. Draws are resolved by the solver, see expandDraws.
+func drawCardsAction(n int32) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		gs.drawCards(n)
+	}
+}
+
+// Only our own deathrattles draw us cards.
+func friendlyDrawDeathrattle(gs *GameState, params *MoveParams) {
+	if getSide(params.CardOne.Zone) == "FRIENDLY" {
+		gs.drawCards(1)
+	}
+}
+
+// An action dealing `amount` damage to the target, plus Spell Damage.
+func damageTargetAction(amount int32) func(gs *GameState, params *MoveParams) {
+	return func(gs *GameState, params *MoveParams) {
+		gs.dealDamage(params.CardTwo, gs.getSpellDamage(params.CardOne, amount))
+	}
+}
+
+// How much damage an effect of `source` really deals: spells get the Spell
+// Damage of their side's minions, anything else deals `amount`.
+func (gs *GameState) getSpellDamage(source *Card, amount int32) int32 {
+	if source == nil || source.Type != "Spell" {
+		return amount
+	}
+	for minion := range gs.CardsByZone[getSide(source.Zone)+" PLAY"] {
+		if !minion.Silenced {
+			amount += minion.SpellPower
+		}
+	}
+	return amount
+}
+
 func getCardPlayedAction(card *Card) func(gs *GameState, params *MoveParams) {
 	if action, ok := GlobalCardPlayedActions[card.JsonCardId]; ok {
 		return action
@@ -93,8 +353,10 @@ func getCardPlayedAction(card *Card) func(gs *GameState, params *MoveParams) {
 
 // All deathrattle actions we care about.  The action should modify `gs`
 var GlobalDeathrattleActions = map[string]func(gs *GameState, params *MoveParams){
-	"FP1_021": whirlwindAction, // Death's Bite
-	"FP1_024": whirlwindAction, // Unstable Ghoul
+	"EX1_096": friendlyDrawDeathrattle, // Loot Hoarder
+	"EX1_012": friendlyDrawDeathrattle, // Bloodmage Thalnos
+	"FP1_021": whirlwindAction,         // Death's Bite
+	"FP1_024": whirlwindAction,         // Unstable Ghoul
 }
 
 func getDeathrattleAction(card *Card) func(gs *GameState, params *MoveParams) {
@@ -103,3 +365,115 @@ func getDeathrattleAction(card *Card) func(gs *GameState, params *MoveParams) {
 	}
 	return func(gs *GameState, params *MoveParams) {}
 }
+
+// Cards that react to events while in play, by JsonCardId and then by
+// event (EVENT_*). See fireTrigger.
+var GlobalTriggerHandlers map[string]map[int]TriggerHandler
+
+// Filled in here rather than in the declaration because handlers like Grim
+// Patron's call back into fireTrigger, which Go treats as a cycle.
+func init() {
+	GlobalTriggerHandlers = map[string]map[int]TriggerHandler{
+		"EX1_604": {EVENT_DAMAGE_TAKEN: frothingBerserkerTrigger},   // Frothing Berserker
+		"EX1_402": {EVENT_DAMAGE_TAKEN: armorsmithTrigger},          // Armorsmith
+		"BRM_019": {EVENT_SURVIVED_DAMAGE: grimPatronTrigger},       // Grim Patron
+		"EX1_084": {EVENT_MINION_SUMMONED: warsongCommanderTrigger}, // Warsong Commander
+		"EX1_007": {EVENT_DAMAGE_TAKEN: acolyteOfPainTrigger},       // Acolyte of Pain
+		// TODO: Knife Juggler (NEW1_019) is random, which chance nodes
+		// don't cover yet.
+	}
+}
+
+func acolyteOfPainTrigger(gs *GameState, owner *Card, ctx *TriggerContext) {
+	// We don't know or care what the opponent draws.
+	if ctx.Subject == owner && getSide(owner.Zone) == "FRIENDLY" {
+		gs.drawCards(1)
+	}
+}
+
+func frothingBerserkerTrigger(gs *GameState, owner *Card, ctx *TriggerContext) {
+	if ctx.Subject.Type == "Minion" {
+		//fmt.Printf("DEBUG: My blade be thirsty! Attack is now %v\n", owner.Attack+1)
+		owner.Attack += 1
+	}
+}
+
+func armorsmithTrigger(gs *GameState, owner *Card, ctx *TriggerContext) {
+	if ctx.Subject.Type == "Minion" && areFriends(owner, ctx.Subject) {
+		if hero := getSingletonFromZone(gs, getSide(owner.Zone)+" PLAY (Hero)", false); hero != nil {
+			hero.Armor += 1
+		}
+	}
+}
+
+func grimPatronTrigger(gs *GameState, owner *Card, ctx *TriggerContext) {
+	// We're not bad people, but we did a bad thing...
+	if ctx.Subject == owner && len(gs.CardsByZone[owner.Zone]) < 7 {
+		//fmt.Println("DEBUG: Everyone! Get in here!")
+		gs.createNewMinionAtPosition("BRM_019", owner.Zone, owner.ZonePosition+1)
+	}
+}
+
+func warsongCommanderTrigger(gs *GameState, owner *Card, ctx *TriggerContext) {
+	if ctx.Subject != owner && ctx.Subject.Zone == owner.Zone && ctx.Subject.Attack <= 3 {
+		//fmt.Println("DEBUG: Getting charge from Warsong Commander.")
+		ctx.Subject.Charge = true
+	}
+}
+
+////////////////////
+
+// Minions whose aura gives the minions next to them extra Attack.
+var adjacencyAttackAuras = map[string]int32{
+	"EX1_565": 2, // Flametongue Totem
+	"EX1_162": 1, // Dire Wolf Alpha
+}
+
+// Does it matter where on the board this minion is played?
+func placementMatters(gs *GameState, card *Card) bool {
+	if _, ok := adjacencyAttackAuras[card.JsonCardId]; ok {
+		return true
+	}
+	if card.JsonCardId == "EX1_093" || positionalEffectCards[card.JsonCardId] { // Defender of Argus
+		return true
+	}
+	for minion := range gs.CardsByZone["FRIENDLY PLAY"] {
+		if _, ok := adjacencyAttackAuras[minion.JsonCardId]; ok && !minion.Silenced {
+			return true
+		}
+	}
+	return false
+}
+
+// How much Attack the minion should be getting from its neighbours' auras.
+func getAdjacencyAura(gs *GameState, minion *Card) int32 {
+	var result int32
+	for _, neighbor := range gs.getAdjacentMinions(minion) {
+		if !neighbor.Silenced {
+			result += adjacencyAttackAuras[neighbor.JsonCardId]
+		}
+	}
+	return result
+}
+
+// Brings every minion's Attack in line with the auras next to it, e.g.
+// after a minion is played beside a Flametongue Totem or one dies.
+func (gs *GameState) updateAdjacencyAuras() {
+	for _, zone := range []string{"FRIENDLY PLAY", "OPPOSING PLAY"} {
+		for minion := range gs.CardsByZone[zone] {
+			aura := getAdjacencyAura(gs, minion)
+			minion.Attack += aura - minion.AuraAttack
+			minion.AuraAttack = aura
+		}
+	}
+}
+
+// The ATK the log reports already includes auras, so just note how much of
+// it they account for.
+func (gs *GameState) assumeAdjacencyAurasApplied() {
+	for _, zone := range []string{"FRIENDLY PLAY", "OPPOSING PLAY"} {
+		for minion := range gs.CardsByZone[zone] {
+			minion.AuraAttack = getAdjacencyAura(gs, minion)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Recognising GameStates we've already seen by another order of moves.
+
+package main
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+)
+
+var stateHashSeed = maphash.MakeSeed()
+
+// Hashes one fact about a GameState at a time (see stateHash). Each value
+// is written whole, strings with a terminator, so e.g. ("ab", "c") and
+// ("a", "bc") hash differently.
+type stateHasher struct {
+	h   maphash.Hash
+	buf [4]byte
+}
+
+func newStateHasher() *stateHasher {
+	s := &stateHasher{}
+	s.h.SetSeed(stateHashSeed)
+	return s
+}
+
+// Starts a new fact. `kind` keeps different sorts of facts apart.
+func (s *stateHasher) begin(kind byte) {
+	s.h.Reset()
+	s.h.WriteByte(kind)
+}
+
+func (s *stateHasher) writeString(v string) {
+	s.h.WriteString(v)
+	s.h.WriteByte(0)
+}
+
+func (s *stateHasher) writeInt32(v int32) {
+	binary.LittleEndian.PutUint32(s.buf[:], uint32(v))
+	s.h.Write(s.buf[:])
+}
+
+func (s *stateHasher) writeBool(v bool) {
+	if v {
+		s.h.WriteByte(1)
+	} else {
+		s.h.WriteByte(0)
+	}
+}
+
+// Everything about a card that affects what can happen next: all of
+// CardInfo (keep the two in step), plus where it sits and when it was
+// played. Like CardInfo, it leaves out the InstanceId, so two copies of a
+// card in the same state look the same.
+func (s *stateHasher) cardHash(c *Card) uint64 {
+	s.begin('c')
+	s.writeString(c.JsonCardId)
+	s.writeString(c.Type)
+	s.writeString(c.Name)
+	s.writeString(c.Zone)
+	for _, v := range [...]int32{c.Cost, c.Attack, c.Health, c.Durability, c.Armor, c.Damage,
+		c.NumAttacksThisTurn, c.SpellPower, c.ZonePosition, c.AuraAttack, c.PlayOrder} {
+		s.writeInt32(v)
+	}
+	for _, v := range [...]bool{c.Charge, c.Exhausted, c.Frozen, c.Taunt, c.DivineShield, c.Windfury,
+		c.Stealth, c.Poisonous, c.Immune, c.CantBeTargetedBySpells, c.CantBeTargetedByHeroPowers,
+		c.Silenced, c.PendingDestroy} {
+		s.writeBool(v)
+	}
+	return s.h.Sum64()
+}
+
+// A Zobrist-style hash of the GameState: every card (and every other fact)
+// gets its own pseudo-random number, and the numbers are added up, so the
+// order of CardsById doesn't matter and identical cards don't cancel out.
+func (gs *GameState) stateHash() uint64 {
+	s := newStateHasher()
+	s.begin('g')
+	for _, v := range [...]int32{gs.ManaMax, gs.ManaUsed, gs.ManaTemp, gs.PendingDraws} {
+		s.writeInt32(v)
+	}
+	sum := s.h.Sum64()
+	for _, card := range gs.CardsById {
+		sum += s.cardHash(card)
+	}
+	for jsonId, count := range gs.RemainingDeck {
+		s.begin('d')
+		s.writeString(jsonId)
+		s.writeInt32(count)
+		sum += s.h.Sum64()
+	}
+	return sum
+}
+
+// Two nodes are interchangeable if they reach the same GameState with the
+// same luck. The draws are part of the hash, since each order of draws is
+// its own chance of winning.
+func hashNode(gs *GameState, moves []*MoveParams) uint64 {
+	var h maphash.Hash
+	h.SetSeed(stateHashSeed)
+	for _, move := range moves {
+		if move.Chance {
+			h.WriteString(move.CardOne.JsonCardId)
+			h.WriteByte(0)
+		}
+	}
+	return gs.stateHash() + h.Sum64()
+}
+
+// The node hashes (see hashNode) a search has already queued up. Only the
+// walk goroutine uses it, like the Frontier. Once it holds `limit` hashes it
+// stops remembering new ones, but still recognises the old ones.
+type TranspositionTable struct {
+	seen  map[uint64]struct{}
+	limit int
+}
+
+func NewTranspositionTable(limit int) *TranspositionTable {
+	return &TranspositionTable{seen: make(map[uint64]struct{}), limit: limit}
+}
+
+// Remembers `hash`, and reports whether it is new.
+func (t *TranspositionTable) Add(hash uint64) bool {
+	if _, exists := t.seen[hash]; exists {
+		return false
+	}
+	if len(t.seen) < t.limit {
+		t.seen[hash] = struct{}{}
+	}
+	return true
+}
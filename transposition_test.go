@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStateHash(t *testing.T) {
+	gs := createEmptyGameState()
+	gs.CreateNewMinion("CS2_182", "FRIENDLY PLAY").Exhausted = false // Chillwind Yeti
+	gs.CreateNewMinion("CS2_182", "FRIENDLY PLAY").Exhausted = false
+	initial := gs.stateHash()
+	if gs.DeepCopy().stateHash() != initial {
+		t.Error("Expected a copy to hash the same")
+	}
+
+	// The same attacks in either order end up in the same place.
+	enemyHero := getSingletonFromZone(&gs, "OPPOSING PLAY (Hero)", true)
+	yetis := gs.getOrderedZone("FRIENDLY PLAY")
+	root := &DecisionTreeNode{Gs: &gs}
+	first := generateNode(generateNode(root, &MoveParams{CardOne: yetis[0], CardTwo: enemyHero}), &MoveParams{CardOne: yetis[1], CardTwo: enemyHero})
+	second := generateNode(generateNode(root, &MoveParams{CardOne: yetis[1], CardTwo: enemyHero}), &MoveParams{CardOne: yetis[0], CardTwo: enemyHero})
+	if first.Hash != second.Hash {
+		t.Error("Expected both orders of attacks to hash the same")
+	}
+	if first.Hash == hashNode(&gs, nil) {
+		t.Error("Expected attacking to change the hash")
+	}
+
+	// Which copy of a card is which doesn't matter, but anything else does.
+	other := createEmptyGameState()
+	other.HighestCardId = 100
+	other.CreateNewMinion("CS2_182", "FRIENDLY PLAY").Exhausted = false
+	other.CreateNewMinion("CS2_182", "FRIENDLY PLAY").Exhausted = false
+	if other.stateHash() != initial {
+		t.Error("Expected InstanceIds not to matter")
+	}
+	other.getOrderedZone("FRIENDLY PLAY")[0].Damage = 1
+	if other.stateHash() == initial {
+		t.Error("Expected damage to matter")
+	}
+}
+
+func TestSolverTranspositions(t *testing.T) {
+	gs := createEmptyGameState()
+	// Three different minions can go face in any order.
+	for _, jsonId := range []string{"CS2_182", "CS2_200", "CS2_119"} { // Yeti, Ogre, Snapjaw
+		gs.CreateNewMinion(jsonId, "FRIENDLY PLAY").Exhausted = false
+	}
+
+	_, stats := NewSolver(SolverOptions{}).SolveAll(context.Background(), gs.DeepCopy())
+	without := DefaultPruningOpts()
+	without.useTranspositionTable = false
+	_, statsWithout := NewSolver(SolverOptions{Pruning: &without}).SolveAll(context.Background(), gs.DeepCopy())
+	if !stats.Exhausted() || !statsWithout.Exhausted() {
+		t.Fatal("Expected both searches to finish:", stats, statsWithout)
+	}
+	if stats.Transpositions == 0 || statsWithout.Transpositions != 0 {
+		t.Error("Expected transpositions only with the table:", stats, statsWithout)
+	}
+	if stats.NodesExplored >= statsWithout.NodesExplored {
+		t.Error("Expected the table to save work:", stats.NodesExplored, "vs", statsWithout.NodesExplored)
+	}
+}
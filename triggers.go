@@ -0,0 +1,100 @@
+// A small event bus so that cards can react to things happening in the game
+// without gamestate.go knowing about them. Handlers live in specialcases.go.
+
+package main
+
+import "sort"
+
+// Things cards can react to.
+const (
+	EVENT_DAMAGE_TAKEN    = iota // Subject took Amount damage.
+	EVENT_SURVIVED_DAMAGE        // Subject took damage and is still alive at the next cleanup.
+	EVENT_MINION_SUMMONED        // Subject just entered play.
+	EVENT_MINION_DIED            // Subject just died and went to the graveyard.
+	EVENT_SPELL_CAST             // Subject was cast, and is about to resolve.
+	EVENT_ATTACK_DECLARED        // Subject is about to attack Target.
+	EVENT_TURN_START             // Subject is the hero whose turn starts. Only OpponentPerspective passes the turn.
+	EVENT_TURN_END               // Subject is the hero whose turn ends.
+	EVENT_CARD_DRAWN             // Subject was drawn into our hand by a hypothetical move.
+)
+
+// What happened, as passed to a TriggerHandler.
+type TriggerContext struct {
+	Event   int
+	Subject *Card
+	Target  *Card // Only for EVENT_ATTACK_DECLARED.
+	Amount  int32 // Only for EVENT_DAMAGE_TAKEN.
+}
+
+// Reacts to an event on behalf of `owner`, the card with the trigger.
+type TriggerHandler func(gs *GameState, owner *Card, ctx *TriggerContext)
+
+// The zones whose cards' triggers are live.
+var triggerZones = []string{
+	"FRIENDLY PLAY", "FRIENDLY PLAY (Hero)", "FRIENDLY PLAY (Weapon)", "FRIENDLY SECRET",
+	"OPPOSING PLAY", "OPPOSING PLAY (Hero)", "OPPOSING PLAY (Weapon)", "OPPOSING SECRET",
+}
+
+// Runs every live, unsilenced handler for the event, in order of play.
+// Returns whether any handler ran.
+func (gs *GameState) fireTrigger(ctx *TriggerContext) bool {
+	var owners []*Card
+	for _, zone := range triggerZones {
+		for card := range gs.CardsByZone[zone] {
+			if card.Silenced {
+				continue
+			}
+			if _, ok := GlobalTriggerHandlers[card.JsonCardId][ctx.Event]; ok {
+				owners = append(owners, card)
+			}
+		}
+	}
+	sortByPlayOrder(owners)
+	ran := false
+	for _, owner := range owners {
+		// Earlier handlers may have killed or silenced this one.
+		if owner.Silenced || !isTriggerZone(owner.Zone) {
+			continue
+		}
+		GlobalTriggerHandlers[owner.JsonCardId][ctx.Event](gs, owner, ctx)
+		ran = true
+	}
+	return ran
+}
+
+func isTriggerZone(zone string) bool {
+	for _, triggerZone := range triggerZones {
+		if zone == triggerZone {
+			return true
+		}
+	}
+	return false
+}
+
+// Sorts cards by when they entered play, earliest first.
+func sortByPlayOrder(cards []*Card) {
+	if len(cards) < 2 {
+		return
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		if cards[i].PlayOrder != cards[j].PlayOrder {
+			return cards[i].PlayOrder < cards[j].PlayOrder
+		}
+		return cards[i].InstanceId < cards[j].InstanceId
+	})
+}
+
+// Are the two cards on the same side of the board?
+func areFriends(a *Card, b *Card) bool {
+	return getSide(a.Zone) == getSide(b.Zone)
+}
+
+// "FRIENDLY" or "OPPOSING", or "" for zones that belong to neither.
+func getSide(zone string) string {
+	for _, side := range []string{"FRIENDLY", "OPPOSING"} {
+		if len(zone) > len(side) && zone[:len(side)+1] == side+" " {
+			return side
+		}
+	}
+	return ""
+}